@@ -3,6 +3,40 @@ package config
 type ActionSvcConfig struct {
 	Name     string          `json:"name" yaml:"name"`
 	Listener *ListenerConfig `json:"listener" yaml:"listener"`
+	// QuarantineAfter is the number of panics after which an action is quarantined, zero uses the default and a negative value disables the quarantine
+	QuarantineAfter int `json:"quarantine_after,omitempty" yaml:"quarantine_after,omitempty" bson:"quarantine_after,omitempty" mapstructure:"quarantine_after,omitempty"`
+	// OrcaloopURL is the base url of the Orcaloop server receiving the results of asynchronous actions
+	OrcaloopURL string `json:"orcaloop_url,omitempty" yaml:"orcaloop_url,omitempty" bson:"orcaloop_url,omitempty" mapstructure:"orcaloop_url,omitempty"`
+	// OutboxPath is the path of the journal of the outbox holding the events until the Orcaloop server acknowledged them, no outbox is used if empty
+	OutboxPath string `json:"outbox_path,omitempty" yaml:"outbox_path,omitempty" bson:"outbox_path,omitempty" mapstructure:"outbox_path,omitempty"`
+	// Async configures the workers running asynchronous actions
+	Async *AsyncConfig `json:"async,omitempty" yaml:"async,omitempty" bson:"async,omitempty" mapstructure:"async,omitempty"`
+	// Executor limits the number of handlers running concurrently
+	Executor *ExecutorConfig `json:"executor,omitempty" yaml:"executor,omitempty" bson:"executor,omitempty" mapstructure:"executor,omitempty"`
+	// ShutdownGracePeriod is the time in milliseconds the running handlers are given to complete when the service stops, zero uses the default
+	ShutdownGracePeriod int64 `json:"shutdown_grace_period,omitempty" yaml:"shutdown_grace_period,omitempty" bson:"shutdown_grace_period,omitempty" mapstructure:"shutdown_grace_period,omitempty"`
+	// Signing configures the HMAC signatures of the requests exchanged with the Orcaloop server, requests are not signed if nil
+	Signing *SigningConfig `json:"signing,omitempty" yaml:"signing,omitempty" bson:"signing,omitempty" mapstructure:"signing,omitempty"`
+}
+
+// SigningConfig configures the HMAC-SHA256 signatures of the requests exchanged with the Orcaloop server.
+type SigningConfig struct {
+	// Secrets are the active shared secrets, requests are signed with the first one and accepted if signed with any of them
+	Secrets []string `json:"secrets,omitempty" yaml:"secrets,omitempty" bson:"secrets,omitempty" mapstructure:"secrets,omitempty"`
+	// Tolerance is the maximum age in milliseconds of the timestamp of a request, zero uses the default
+	Tolerance int64 `json:"tolerance,omitempty" yaml:"tolerance,omitempty" bson:"tolerance,omitempty" mapstructure:"tolerance,omitempty"`
+	// MaxBodySize is the maximum size in bytes of the body of a signed request, larger requests are rejected, zero uses the default
+	MaxBodySize int64 `json:"max_body_size,omitempty" yaml:"max_body_size,omitempty" bson:"max_body_size,omitempty" mapstructure:"max_body_size,omitempty"`
+}
+
+// AsyncConfig configures the execution of the actions whose spec is Async.
+type AsyncConfig struct {
+	// Workers is the number of actions run concurrently
+	Workers int `json:"workers,omitempty" yaml:"workers,omitempty" bson:"workers,omitempty" mapstructure:"workers,omitempty"`
+	// QueueSize is the number of actions waiting for a worker, requests are rejected once the queue is full
+	QueueSize int `json:"queue_size,omitempty" yaml:"queue_size,omitempty" bson:"queue_size,omitempty" mapstructure:"queue_size,omitempty"`
+	// HeartbeatInterval is the interval in milliseconds of the heartbeats sent while an action runs, zero uses the default and a negative value disables the heartbeats
+	HeartbeatInterval int64 `json:"heartbeat_interval,omitempty" yaml:"heartbeat_interval,omitempty" bson:"heartbeat_interval,omitempty" mapstructure:"heartbeat_interval,omitempty"`
 }
 
 type ListenerConfig struct {
@@ -14,3 +48,14 @@ type ListenerConfig struct {
 	PrivateKeyPath string `json:"private_key_path,omitempty" yaml:"private_key_path,omitempty" bson:"private_key_path,omitempty" mapstructure:"private_key,omitempty"`
 	CertPath       string `json:"cert_path,omitempty" yaml:"cert_path,omitempty" bson:"cert_path,omitempty" mapstructure:"cert,omitempty"`
 }
+
+// ExecutorConfig limits the number of handlers running concurrently, whether they are invoked
+// through the REST api or through messaging. Limits that are not positive mean no limit.
+type ExecutorConfig struct {
+	// MaxInFlight is the number of handlers running concurrently across all the actions
+	MaxInFlight int `json:"max_in_flight,omitempty" yaml:"max_in_flight,omitempty" bson:"max_in_flight,omitempty" mapstructure:"max_in_flight,omitempty"`
+	// QueueDepth is the number of REST invocations waiting for a slot, further invocations are rejected with 429 Too Many Requests
+	QueueDepth int `json:"queue_depth,omitempty" yaml:"queue_depth,omitempty" bson:"queue_depth,omitempty" mapstructure:"queue_depth,omitempty"`
+	// ActionLimits is the number of handlers running concurrently per action id
+	ActionLimits map[string]int `json:"action_limits,omitempty" yaml:"action_limits,omitempty" bson:"action_limits,omitempty" mapstructure:"action_limits,omitempty"`
+}
@@ -0,0 +1,244 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TypeMismatchError is returned when an operator is applied to operands of types it does not support.
+// It names the operator, its position in the expression and each operand with its type.
+// Right and RightType are empty for unary operators.
+type TypeMismatchError struct {
+	Op        string
+	Pos       int
+	Left      string
+	LeftType  string
+	Right     string
+	RightType string
+}
+
+// Error implements the error interface.
+func (e *TypeMismatchError) Error() string {
+	if e.Right == "" && e.RightType == "" {
+		return fmt.Sprintf("type mismatch at position %d: operator %s cannot be applied to %s (%s)", e.Pos, e.Op, e.Left, e.LeftType)
+	}
+	return fmt.Sprintf("type mismatch at position %d: operator %s cannot be applied to %s (%s) and %s (%s)",
+		e.Pos, e.Op, e.Left, e.LeftType, e.Right, e.RightType)
+}
+
+// typeName returns the name of the type of the value used in error messages.
+func typeName(v any) string {
+	if v == nil {
+		return "null"
+	}
+	return reflect.TypeOf(v).String()
+}
+
+// DateLayouts are the layouts used to parse date strings when they are compared with time.Time values.
+var DateLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	time.DateOnly,
+}
+
+// numericKind is the kind of a numeric value after promotion.
+type numericKind int
+
+const (
+	numericInt numericKind = iota
+	numericUint
+	numericFloat
+)
+
+// numeric is a numeric value promoted to int64, uint64 or float64.
+// Integers are kept as integers so that large values are compared without loss of precision.
+type numeric struct {
+	kind numericKind
+	i    int64
+	u    uint64
+	f    float64
+}
+
+// float returns the value of the numeric as a float64.
+func (n numeric) float() float64 {
+	switch n.kind {
+	case numericInt:
+		return float64(n.i)
+	case numericUint:
+		return float64(n.u)
+	default:
+		return n.f
+	}
+}
+
+// toNumeric promotes a value of any Go numeric type, including named numeric types, or a json.Number to a numeric.
+// Strings are not converted, see parseNumeric.
+func toNumeric(v any) (n numeric, ok bool) {
+	switch x := v.(type) {
+	case float64:
+		return numeric{kind: numericFloat, f: x}, true
+	case int:
+		return numeric{kind: numericInt, i: int64(x)}, true
+	case int64:
+		return numeric{kind: numericInt, i: x}, true
+	case json.Number:
+		return parseNumeric(string(x))
+	case nil, string, bool:
+		return
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return numeric{kind: numericInt, i: rv.Int()}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return numeric{kind: numericUint, u: rv.Uint()}, true
+	case reflect.Float32, reflect.Float64:
+		return numeric{kind: numericFloat, f: rv.Float()}, true
+	}
+	return
+}
+
+// parseNumeric parses a numeric string. Integers are parsed as int64 or uint64 if they fit, otherwise as float64.
+func parseNumeric(s string) (n numeric, ok bool) {
+	s = strings.TrimSpace(s)
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return numeric{kind: numericInt, i: i}, true
+	}
+	if u, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return numeric{kind: numericUint, u: u}, true
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return numeric{kind: numericFloat, f: f}, true
+	}
+	return
+}
+
+// toNumber converts the value to a float64 if it is of a numeric type or a json.Number.
+func toNumber(v any) (float64, bool) {
+	n, ok := toNumeric(v)
+	return n.float(), ok
+}
+
+// compareNumeric compares two numerics and returns -1, 0 or 1.
+// Integers are compared exactly, mixed integer and float values are compared as float64.
+func compareNumeric(a, b numeric) int {
+	if a.kind == numericFloat || b.kind == numericFloat {
+		x, y := a.float(), b.float()
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		default:
+			return 0
+		}
+	}
+	switch {
+	case a.kind == numericInt && b.kind == numericInt:
+		return compareOrdered(a.i, b.i)
+	case a.kind == numericUint && b.kind == numericUint:
+		return compareOrdered(a.u, b.u)
+	case a.kind == numericInt:
+		if a.i < 0 {
+			return -1
+		}
+		return compareOrdered(uint64(a.i), b.u)
+	default:
+		if b.i < 0 {
+			return 1
+		}
+		return compareOrdered(a.u, uint64(b.i))
+	}
+}
+
+// compareOrdered compares two ordered values and returns -1, 0 or 1.
+func compareOrdered[T int64 | uint64 | string](a, b T) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	default:
+		return 0
+	}
+}
+
+// toTime converts the value to a time.Time if it is a time.Time or a *time.Time.
+func toTime(v any) (t time.Time, ok bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case *time.Time:
+		if x != nil {
+			return *x, true
+		}
+	}
+	return
+}
+
+// parseTime parses a date string using the DateLayouts.
+func parseTime(s string) (t time.Time, ok bool) {
+	for _, layout := range DateLayouts {
+		if parsed, err := time.Parse(layout, s); err == nil {
+			return parsed, true
+		}
+	}
+	return
+}
+
+// compareValues compares two values and returns -1, 0 or 1.
+// The values are compared
+//   - numerically if both are numeric, or one is numeric and the other is a numeric string
+//   - chronologically if both are times, or one is a time and the other is a date string
+//   - lexically if both are strings
+//
+// ok is false if the values cannot be compared.
+func compareValues(a, b any) (result int, ok bool) {
+	na, isNumA := toNumeric(a)
+	nb, isNumB := toNumeric(b)
+	sa, isStrA := a.(string)
+	sb, isStrB := b.(string)
+	switch {
+	case isNumA && isNumB:
+		return compareNumeric(na, nb), true
+	case isNumA && isStrB:
+		if nb, ok = parseNumeric(sb); ok {
+			result = compareNumeric(na, nb)
+		}
+		return
+	case isStrA && isNumB:
+		if na, ok = parseNumeric(sa); ok {
+			result = compareNumeric(na, nb)
+		}
+		return
+	}
+	ta, isTimeA := toTime(a)
+	tb, isTimeB := toTime(b)
+	if isTimeA && isStrB {
+		tb, isTimeB = parseTime(sb)
+	} else if isStrA && isTimeB {
+		ta, isTimeA = parseTime(sa)
+	}
+	if isTimeA && isTimeB {
+		return ta.Compare(tb), true
+	}
+	if isStrA && isStrB {
+		return compareOrdered(sa, sb), true
+	}
+	return
+}
+
+// Equal checks if the values are equal the way the == operator of a condition does.
+// Numeric values, numeric strings, times and date strings are equal if they compare as equal
+// after promotion, all other values are compared deeply.
+func Equal(a, b any) bool {
+	if result, ok := compareValues(a, b); ok {
+		return result == 0
+	}
+	return reflect.DeepEqual(a, b)
+}
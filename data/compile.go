@@ -0,0 +1,187 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"sync"
+)
+
+// DefaultExprCacheSize is the maximum number of expressions held by the DefaultExprCache.
+const DefaultExprCacheSize = 1024
+
+// DefaultExprCache is the cache used by CompileCondition and Pipeline.EvaluateCondition.
+var DefaultExprCache = NewExprCache(DefaultExprCacheSize)
+
+// Expr is a compiled expression. It holds the abstract syntax tree of the expression
+// and can be evaluated any number of times against different pipelines.
+// An Expr is immutable and safe for concurrent use.
+type Expr struct {
+	source string
+	root   node
+}
+
+// Compile parses the expression into a reusable Expr without consulting any cache.
+// Regular expressions given as string literals are compiled as well, so that invalid
+// patterns are reported as a *SyntaxError.
+//
+// Parameters:
+//   - expression: The expression to be compiled.
+//
+// Returns:
+//   - expr: The compiled expression.
+//   - err: A *SyntaxError if the expression is invalid, otherwise nil.
+func Compile(expression string) (expr *Expr, err error) {
+	var root node
+	root, err = parse(expression)
+	if err != nil {
+		return
+	}
+	err = precompile(root)
+	if err != nil {
+		return
+	}
+	expr = &Expr{
+		source: expression,
+		root:   root,
+	}
+	return
+}
+
+// CompileCondition returns the compiled form of the condition from the DefaultExprCache,
+// compiling and caching it if it is not cached yet.
+//
+// Parameters:
+//   - condition: The condition to be compiled.
+//
+// Returns:
+//   - expr: The compiled condition.
+//   - err: A *SyntaxError if the condition is invalid, otherwise nil.
+func CompileCondition(condition string) (*Expr, error) {
+	return DefaultExprCache.Get(condition)
+}
+
+// String returns the source text of the expression.
+func (e *Expr) String() string {
+	return e.source
+}
+
+// Eval evaluates the expression using the variables from the pipeline and returns its value.
+func (e *Expr) Eval(pipeline *Pipeline) (any, error) {
+	return e.root.eval(pipeline)
+}
+
+// Evaluate evaluates the expression using the variables from the pipeline.
+// It returns an error if the expression does not evaluate to a boolean.
+func (e *Expr) Evaluate(pipeline *Pipeline) (bool, error) {
+	result, err := e.root.eval(pipeline)
+	if err != nil {
+		return false, err
+	}
+	b, ok := result.(bool)
+	if !ok {
+		return false, fmt.Errorf("condition %q does not evaluate to a boolean, got %T", e.source, result)
+	}
+	return b, nil
+}
+
+// precompile walks the tree and compiles the regular expressions that are given as string literals.
+func precompile(n node) (err error) {
+	switch v := n.(type) {
+	case *binaryNode:
+		if err = precompile(v.left); err != nil {
+			return
+		}
+		if err = precompile(v.right); err != nil {
+			return
+		}
+		if v.op == "matches" || v.op == "=~" {
+			if lit, ok := v.right.(*literalNode); ok {
+				pattern, isStr := lit.value.(string)
+				if !isStr {
+					return &SyntaxError{Pos: lit.pos, Msg: fmt.Sprintf("operator %s requires a string pattern", v.op)}
+				}
+				v.re, err = regexp.Compile(pattern)
+				if err != nil {
+					return &SyntaxError{Pos: lit.pos, Msg: "invalid regular expression: " + err.Error()}
+				}
+			}
+		}
+	case *unaryNode:
+		err = precompile(v.operand)
+	case *listNode:
+		for _, item := range v.items {
+			if err = precompile(item); err != nil {
+				return
+			}
+		}
+	case *pathNode:
+		for _, seg := range v.segments {
+			if seg.index != nil {
+				if err = precompile(seg.index); err != nil {
+					return
+				}
+			}
+		}
+	}
+	return
+}
+
+// ExprCache is a concurrency-safe cache of compiled expressions keyed by the expression text.
+// Expressions that fail to compile are not cached. Once the cache holds maxSize expressions,
+// an arbitrary entry is evicted for every new expression.
+type ExprCache struct {
+	mu      sync.RWMutex
+	exprs   map[string]*Expr
+	maxSize int
+}
+
+// NewExprCache creates a new ExprCache holding at most maxSize expressions.
+// A maxSize of zero or less makes the cache unbounded.
+func NewExprCache(maxSize int) *ExprCache {
+	return &ExprCache{
+		exprs:   make(map[string]*Expr),
+		maxSize: maxSize,
+	}
+}
+
+// Get returns the compiled expression, compiling and caching it if it is not cached yet.
+func (c *ExprCache) Get(expression string) (expr *Expr, err error) {
+	c.mu.RLock()
+	expr, ok := c.exprs[expression]
+	c.mu.RUnlock()
+	if ok {
+		return
+	}
+	expr, err = Compile(expression)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if cached, ok := c.exprs[expression]; ok {
+		expr = cached
+		return
+	}
+	if c.maxSize > 0 && len(c.exprs) >= c.maxSize {
+		for k := range c.exprs {
+			delete(c.exprs, k)
+			break
+		}
+	}
+	c.exprs[expression] = expr
+	return
+}
+
+// Len returns the number of expressions held by the cache.
+func (c *ExprCache) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.exprs)
+}
+
+// Clear removes all the expressions from the cache.
+func (c *ExprCache) Clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.exprs = make(map[string]*Expr)
+}
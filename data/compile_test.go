@@ -0,0 +1,82 @@
+package data
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestCompile(t *testing.T) {
+	expr, err := Compile("count * 2 > limit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expr.String() != "count * 2 > limit" {
+		t.Fatalf("String() = %q", expr.String())
+	}
+	for _, tt := range []struct {
+		count, limit int
+		want         bool
+	}{{count: 3, limit: 5, want: true}, {count: 2, limit: 5, want: false}} {
+		p := NewPipeline("id")
+		p.Set("count", tt.count)
+		p.Set("limit", tt.limit)
+		got, err := expr.Evaluate(p)
+		if err != nil || got != tt.want {
+			t.Fatalf("Evaluate(count=%d, limit=%d) = %v, %v, want %v", tt.count, tt.limit, got, err, tt.want)
+		}
+	}
+
+	sum, _ := Compile("1 + 2")
+	if v, err := sum.Eval(NewPipeline("id")); err != nil || v != float64(3) {
+		t.Fatalf("Eval() = %#v, %v", v, err)
+	}
+	if _, err = sum.Evaluate(NewPipeline("id")); err == nil {
+		t.Fatal("Evaluate() accepted a number")
+	}
+	var syntaxErr *SyntaxError
+	if _, err = Compile(`a =~ "["`); !errors.As(err, &syntaxErr) {
+		t.Fatalf("Compile() of an invalid pattern error = %v, want a *SyntaxError", err)
+	}
+}
+
+func TestExprCache(t *testing.T) {
+	cache := NewExprCache(2)
+	first, err := cache.Get("a == 1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again, _ := cache.Get("a == 1"); again != first {
+		t.Fatal("Get() compiled a cached expression again")
+	}
+	if _, err = cache.Get("a =="); err == nil || cache.Len() != 1 {
+		t.Fatalf("Get() of an invalid expression error = %v, len = %d", err, cache.Len())
+	}
+	cache.Get("b == 1")
+	cache.Get("c == 1")
+	if cache.Len() != 2 {
+		t.Fatalf("Len() = %d, want the max size 2", cache.Len())
+	}
+	cache.Clear()
+	if cache.Len() != 0 {
+		t.Fatalf("Len() after Clear() = %d", cache.Len())
+	}
+
+	unbounded := NewExprCache(0)
+	var wg sync.WaitGroup
+	exprs := make([]*Expr, 8)
+	for i := range exprs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			exprs[i], _ = unbounded.Get("x > 1")
+		}(i)
+	}
+	wg.Wait()
+	cached, _ := unbounded.Get("x > 1")
+	for _, expr := range exprs {
+		if expr != cached {
+			t.Fatal("concurrent Get() returned different expressions")
+		}
+	}
+}
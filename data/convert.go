@@ -0,0 +1,377 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+// conversionError creates an error wrapping ErrInvalidType for a value that cannot be converted to the target type.
+func conversionError(v any, target string, reason ...string) error {
+	if len(reason) > 0 {
+		return fmt.Errorf("%w: cannot convert %v (%s) to %s: %s", ErrInvalidType, v, typeName(v), target, strings.Join(reason, ", "))
+	}
+	return fmt.Errorf("%w: cannot convert %v (%s) to %s", ErrInvalidType, v, typeName(v), target)
+}
+
+// toNumericValue converts numeric values, json.Number and numeric strings to a numeric.
+func toNumericValue(v any) (n numeric, ok bool) {
+	if s, isStr := v.(string); isStr {
+		return parseNumeric(s)
+	}
+	return toNumeric(v)
+}
+
+// ToInt64 converts the value to an int64.
+// Values of any numeric type, json.Number and numeric strings are converted as long as they
+// are integral and fit into an int64. Floating point values with a fractional part are rejected.
+//
+// Parameters:
+//   - v: The value to be converted.
+//
+// Returns:
+//   - int64: The converted value.
+//   - error: An error wrapping ErrInvalidType if the value cannot be converted.
+func ToInt64(v any) (int64, error) {
+	n, ok := toNumericValue(v)
+	if !ok {
+		return 0, conversionError(v, "int64")
+	}
+	switch n.kind {
+	case numericInt:
+		return n.i, nil
+	case numericUint:
+		if n.u > math.MaxInt64 {
+			return 0, conversionError(v, "int64", "value out of range")
+		}
+		return int64(n.u), nil
+	default:
+		if n.f != math.Trunc(n.f) || math.IsInf(n.f, 0) || math.IsNaN(n.f) {
+			return 0, conversionError(v, "int64", "value is not integral")
+		}
+		if n.f < math.MinInt64 || n.f >= math.MaxInt64 {
+			return 0, conversionError(v, "int64", "value out of range")
+		}
+		return int64(n.f), nil
+	}
+}
+
+// ToInt converts the value to an int using the same rules as ToInt64.
+func ToInt(v any) (int, error) {
+	i, err := ToInt64(v)
+	if err != nil {
+		return 0, err
+	}
+	if i < math.MinInt || i > math.MaxInt {
+		return 0, conversionError(v, "int", "value out of range")
+	}
+	return int(i), nil
+}
+
+// ToFloat64 converts the value to a float64.
+// Values of any numeric type, json.Number and numeric strings are converted.
+func ToFloat64(v any) (float64, error) {
+	n, ok := toNumericValue(v)
+	if !ok {
+		return 0, conversionError(v, "float64")
+	}
+	return n.float(), nil
+}
+
+// ToBool converts the value to a bool.
+// Strings are parsed using strconv.ParseBool and numeric values are true if they are not zero.
+func ToBool(v any) (bool, error) {
+	switch b := v.(type) {
+	case bool:
+		return b, nil
+	case string:
+		parsed, err := strconv.ParseBool(strings.TrimSpace(b))
+		if err != nil {
+			return false, conversionError(v, "bool")
+		}
+		return parsed, nil
+	}
+	if n, ok := toNumeric(v); ok {
+		return n.float() != 0, nil
+	}
+	return false, conversionError(v, "bool")
+}
+
+// ToString converts the value to a string.
+// Numbers and booleans are formatted using strconv, times are formatted as RFC 3339,
+// byte slices are converted as is and fmt.Stringer values use their String method.
+// Maps, arrays and other composite values are rejected.
+func ToString(v any) (string, error) {
+	switch s := v.(type) {
+	case string:
+		return s, nil
+	case []byte:
+		return string(s), nil
+	case json.Number:
+		return s.String(), nil
+	case bool:
+		return strconv.FormatBool(s), nil
+	case time.Time:
+		return s.Format(time.RFC3339Nano), nil
+	case fmt.Stringer:
+		return s.String(), nil
+	}
+	if n, ok := toNumeric(v); ok {
+		switch n.kind {
+		case numericInt:
+			return strconv.FormatInt(n.i, 10), nil
+		case numericUint:
+			return strconv.FormatUint(n.u, 10), nil
+		default:
+			return strconv.FormatFloat(n.f, 'f', -1, 64), nil
+		}
+	}
+	return "", conversionError(v, "string")
+}
+
+// ToTime converts the value to a time.Time.
+// Strings are parsed using the DateLayouts.
+func ToTime(v any) (time.Time, error) {
+	if t, ok := toTime(v); ok {
+		return t, nil
+	}
+	if s, ok := v.(string); ok {
+		if t, ok := parseTime(strings.TrimSpace(s)); ok {
+			return t, nil
+		}
+	}
+	return time.Time{}, conversionError(v, "time.Time")
+}
+
+// ToSlice converts the value to a []any. Slices and arrays of any element type are converted.
+func ToSlice(v any) ([]any, error) {
+	if s, ok := v.([]any); ok {
+		return s, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, conversionError(v, "[]any")
+	}
+	s := make([]any, rv.Len())
+	for i := range s {
+		s[i] = rv.Index(i).Interface()
+	}
+	return s, nil
+}
+
+// ToMap converts the value to a map[string]any. Maps with keys of a string kind are converted.
+func ToMap(v any) (map[string]any, error) {
+	if m, ok := v.(map[string]any); ok {
+		return m, nil
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, conversionError(v, "map[string]any")
+	}
+	m := make(map[string]any, rv.Len())
+	iter := rv.MapRange()
+	for iter.Next() {
+		m[iter.Key().String()] = iter.Value().Interface()
+	}
+	return m, nil
+}
+
+// CoerceTo converts the value to the Go type of the schema type.
+//
+//   - FieldTypeString: string
+//   - FieldTypeDateStr: time.Time
+//   - FieldTypeInt: int
+//   - FieldTypeInt64: int64
+//   - FieldTypeFloat32: float32
+//   - FieldTypeFloat64: float64
+//   - FieldTypeBool: bool
+//   - FieldTypeByte: byte
+//   - FieldTypeObject: map[string]any with each of the Properties coerced
+//   - FieldTypeArray: []any with each element coerced to the Items schema
+//
+// Nil values and values of a schema without a type are returned unchanged.
+//
+// Parameters:
+//   - value: The value to be converted.
+//   - schema: The schema describing the target type.
+//
+// Returns:
+//   - any: The converted value.
+//   - error: An error wrapping ErrInvalidType if the value or any nested value cannot be converted.
+func CoerceTo(value any, schema *models.Schema) (result any, err error) {
+	if value == nil || schema == nil {
+		return value, nil
+	}
+	switch schema.Type {
+	case models.FieldTypeString:
+		return ToString(value)
+	case models.FieldTypeDateStr:
+		return ToTime(value)
+	case models.FieldTypeInt:
+		return ToInt(value)
+	case models.FieldTypeInt64:
+		return ToInt64(value)
+	case models.FieldTypeFloat32:
+		var f float64
+		f, err = ToFloat64(value)
+		if err == nil && math.Abs(f) > math.MaxFloat32 && !math.IsInf(f, 0) {
+			err = conversionError(value, "float32", "value out of range")
+		}
+		return float32(f), err
+	case models.FieldTypeFloat64:
+		return ToFloat64(value)
+	case models.FieldTypeBool:
+		return ToBool(value)
+	case models.FieldTypeByte:
+		var i int64
+		i, err = ToInt64(value)
+		if err == nil && (i < 0 || i > math.MaxUint8) {
+			err = conversionError(value, "byte", "value out of range")
+		}
+		return byte(i), err
+	case models.FieldTypeObject:
+		var m map[string]any
+		m, err = ToMap(value)
+		if err != nil || len(schema.Properties) == 0 {
+			return m, err
+		}
+		coerced := make(map[string]any, len(m))
+		for k, v := range m {
+			coerced[k] = v
+		}
+		var errs []error
+		for _, property := range schema.Properties {
+			v, ok := coerced[property.Name]
+			if !ok {
+				continue
+			}
+			if coerced[property.Name], err = CoerceTo(v, property); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", property.Name, err))
+			}
+		}
+		return coerced, errors.Join(errs...)
+	case models.FieldTypeArray:
+		var s []any
+		s, err = ToSlice(value)
+		if err != nil || schema.Items == nil {
+			return s, err
+		}
+		coerced := make([]any, len(s))
+		var errs []error
+		for i, v := range s {
+			if coerced[i], err = CoerceTo(v, schema.Items); err != nil {
+				errs = append(errs, fmt.Errorf("[%d]: %w", i, err))
+			}
+		}
+		return coerced, errors.Join(errs...)
+	default:
+		return value, nil
+	}
+}
+
+// Coerce converts the values of the pipeline named by the schemas using CoerceTo.
+// Schemas whose names are not present in the pipeline are ignored.
+//
+// Parameters:
+//   - schemas: The schemas of the values to be converted, usually the Parameters of an ActionSpec.
+//
+// Returns:
+//
+//	An error joining the conversion errors of all the values, otherwise nil.
+func (p *Pipeline) Coerce(schemas []*models.Schema) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var errs []error
+	for _, schema := range schemas {
+		v, ok := p.lookup(schema.Name)
+		if !ok {
+			continue
+		}
+		coerced, err := CoerceTo(v, schema)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", schema.Name, err))
+			continue
+		}
+		p.set(schema.Name, coerced)
+	}
+	return errors.Join(errs...)
+}
+
+// GetInt retrieves the value of the key converted to an int, see ToInt.
+func (p *Pipeline) GetInt(key string) (int, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return ToInt(v)
+}
+
+// GetInt64 retrieves the value of the key converted to an int64, see ToInt64.
+func (p *Pipeline) GetInt64(key string) (int64, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return ToInt64(v)
+}
+
+// GetFloat retrieves the value of the key converted to a float64, see ToFloat64.
+func (p *Pipeline) GetFloat(key string) (float64, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return 0, err
+	}
+	return ToFloat64(v)
+}
+
+// GetBool retrieves the value of the key converted to a bool, see ToBool.
+func (p *Pipeline) GetBool(key string) (bool, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return false, err
+	}
+	return ToBool(v)
+}
+
+// GetString retrieves the value of the key converted to a string, see ToString.
+func (p *Pipeline) GetString(key string) (string, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return "", err
+	}
+	return ToString(v)
+}
+
+// GetTime retrieves the value of the key converted to a time.Time, see ToTime.
+func (p *Pipeline) GetTime(key string) (time.Time, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return ToTime(v)
+}
+
+// GetSlice retrieves the value of the key converted to a []any, see ToSlice.
+func (p *Pipeline) GetSlice(key string) ([]any, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return ToSlice(v)
+}
+
+// GetMap retrieves the value of the key converted to a map[string]any, see ToMap.
+func (p *Pipeline) GetMap(key string) (map[string]any, error) {
+	v, err := p.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	return ToMap(v)
+}
@@ -0,0 +1,114 @@
+package data
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+func TestToInt64(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      any
+		want    int64
+		wantErr bool
+	}{
+		{name: "int", in: 42, want: 42},
+		{name: "uint8", in: uint8(7), want: 7},
+		{name: "integral float", in: 3.0, want: 3},
+		{name: "json number", in: json.Number("9007199254740993"), want: 9007199254740993},
+		{name: "numeric string", in: "-12", want: -12},
+		{name: "fractional float", in: 1.5, wantErr: true},
+		{name: "uint out of range", in: uint64(1 << 63), wantErr: true},
+		{name: "text", in: "abc", wantErr: true},
+		{name: "bool", in: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ToInt64(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidType) {
+					t.Fatalf("ToInt64(%v) error = %v, want ErrInvalidType", tt.in, err)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Fatalf("ToInt64(%v) = %v, %v, want %v", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestToBoolAndString(t *testing.T) {
+	if b, err := ToBool("true"); err != nil || !b {
+		t.Fatalf("ToBool(\"true\") = %v, %v", b, err)
+	}
+	if b, err := ToBool(0); err != nil || b {
+		t.Fatalf("ToBool(0) = %v, %v", b, err)
+	}
+	if _, err := ToBool("maybe"); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("ToBool(\"maybe\") error = %v", err)
+	}
+	if s, err := ToString(1.25); err != nil || s != "1.25" {
+		t.Fatalf("ToString(1.25) = %v, %v", s, err)
+	}
+	if _, err := ToString(map[string]any{}); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("ToString(map) error = %v", err)
+	}
+}
+
+func TestToTime(t *testing.T) {
+	want := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	got, err := ToTime("2024-05-01T10:00:00Z")
+	if err != nil || !got.Equal(want) {
+		t.Fatalf("ToTime() = %v, %v, want %v", got, err, want)
+	}
+	if _, err = ToTime("yesterday"); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("ToTime(\"yesterday\") error = %v", err)
+	}
+}
+
+func TestCoerceTo(t *testing.T) {
+	schema := &models.Schema{
+		Type: models.FieldTypeObject,
+		Properties: []*models.Schema{
+			{Name: "count", Type: models.FieldTypeInt},
+			{Name: "tags", Type: models.FieldTypeArray, Items: &models.Schema{Type: models.FieldTypeString}},
+		},
+	}
+	got, err := CoerceTo(map[string]any{"count": "3", "tags": []any{1, true}, "other": 1.5}, schema)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{"count": 3, "tags": []any{"1", "true"}, "other": 1.5}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("CoerceTo() = %#v, want %#v", got, want)
+	}
+	if _, err = CoerceTo(map[string]any{"count": "x"}, schema); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("CoerceTo() error = %v, want ErrInvalidType", err)
+	}
+}
+
+func TestPipelineCoerce(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("a", "10")
+	p.Set("b", "x")
+	err := p.Coerce([]*models.Schema{
+		{Name: "a", Type: models.FieldTypeInt64},
+		{Name: "b", Type: models.FieldTypeBool},
+		{Name: "missing", Type: models.FieldTypeInt},
+	})
+	if !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("Coerce() error = %v, want ErrInvalidType", err)
+	}
+	if a, _ := p.Get("a"); a != int64(10) {
+		t.Fatalf("a = %#v, want int64(10)", a)
+	}
+	if p.Has("missing") {
+		t.Fatal("Coerce() set a missing value")
+	}
+}
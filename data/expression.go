@@ -0,0 +1,541 @@
+package data
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// SyntaxError is returned when an expression cannot be parsed.
+// Pos is the 1-based position of the character in the expression where the error was detected.
+type SyntaxError struct {
+	Pos int
+	Msg string
+}
+
+// Error implements the error interface.
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at position %d: %s", e.Pos, e.Msg)
+}
+
+// tokenKind is the kind of a lexical token of an expression.
+type tokenKind int
+
+const (
+	tokenEOF tokenKind = iota
+	tokenNumber
+	tokenString
+	tokenIdent
+	tokenOperator
+	tokenLParen
+	tokenRParen
+	tokenLBracket
+	tokenRBracket
+	tokenDot
+	tokenComma
+)
+
+// token is a lexical token of an expression.
+// pos is the 1-based position of the first character of the token.
+type token struct {
+	kind  tokenKind
+	text  string
+	value any
+	pos   int
+}
+
+// keywords that are binary operators when they follow an operand. They are lexed as identifiers,
+// so that they remain valid variable and field names anywhere else, e.g. in in list.
+var keywordOperators = map[string]bool{
+	"in":       true,
+	"contains": true,
+	"matches":  true,
+}
+
+// lexer splits an expression into tokens.
+type lexer struct {
+	input []rune
+	pos   int
+}
+
+// tokenize splits the expression into tokens for parsing.
+// The returned slice always ends with a tokenEOF token.
+func tokenize(expression string) (tokens []token, err error) {
+	l := &lexer{input: []rune(expression)}
+	for {
+		var tok token
+		tok, err = l.next()
+		if err != nil {
+			return
+		}
+		tokens = append(tokens, tok)
+		if tok.kind == tokenEOF {
+			return
+		}
+	}
+}
+
+// next returns the next token of the input.
+func (l *lexer) next() (tok token, err error) {
+	for l.pos < len(l.input) && unicode.IsSpace(l.input[l.pos]) {
+		l.pos++
+	}
+	start := l.pos
+	tok.pos = start + 1
+	if l.pos >= len(l.input) {
+		tok.kind = tokenEOF
+		return
+	}
+	ch := l.input[l.pos]
+	switch {
+	case ch == '"' || ch == '\'':
+		return l.lexString()
+	case unicode.IsDigit(ch):
+		return l.lexNumber()
+	case ch == '_' || ch == '$' || unicode.IsLetter(ch):
+		for l.pos < len(l.input) && isIdentRune(l.input[l.pos]) {
+			l.pos++
+		}
+		tok.text = string(l.input[start:l.pos])
+		tok.kind = tokenIdent
+		// a-b and a-1 are rejected rather than read as subtractions so that conditions referencing
+		// variables whose names contain '-' fail to compile instead of evaluating differently
+		if l.pos+1 < len(l.input) && l.input[l.pos] == '-' && isIdentRune(l.input[l.pos+1]) {
+			err = &SyntaxError{Pos: l.pos + 1, Msg: fmt.Sprintf("unexpected '-' after %q, variable names cannot contain '-' and subtractions of variables need spaces around '-'", tok.text)}
+		}
+		return
+	}
+	l.pos++
+	tok.text = string(ch)
+	switch ch {
+	case '(':
+		tok.kind = tokenLParen
+	case ')':
+		tok.kind = tokenRParen
+	case '[':
+		tok.kind = tokenLBracket
+	case ']':
+		tok.kind = tokenRBracket
+	case '.':
+		tok.kind = tokenDot
+	case ',':
+		tok.kind = tokenComma
+	case '+', '-', '*', '/', '%':
+		tok.kind = tokenOperator
+	case '=', '!', '<', '>':
+		tok.kind = tokenOperator
+		if l.pos < len(l.input) && (l.input[l.pos] == '=' || (ch == '=' && l.input[l.pos] == '~')) {
+			tok.text += string(l.input[l.pos])
+			l.pos++
+		}
+		if tok.text == "=" {
+			err = &SyntaxError{Pos: tok.pos, Msg: "unexpected '=', did you mean '=='?"}
+		}
+	case '&', '|':
+		if l.pos < len(l.input) && l.input[l.pos] == ch {
+			l.pos++
+			tok.kind = tokenOperator
+			tok.text = string([]rune{ch, ch})
+		} else {
+			err = &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected '%c', did you mean '%c%c'?", ch, ch, ch)}
+		}
+	default:
+		err = &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected character '%c'", ch)}
+	}
+	return
+}
+
+// lexString reads a single or double quoted string literal.
+// The supported escape sequences are \\, \", \', \n, \r and \t.
+func (l *lexer) lexString() (tok token, err error) {
+	quote := l.input[l.pos]
+	tok.pos = l.pos + 1
+	tok.kind = tokenString
+	l.pos++
+	var sb strings.Builder
+	for l.pos < len(l.input) {
+		ch := l.input[l.pos]
+		l.pos++
+		switch ch {
+		case quote:
+			tok.value = sb.String()
+			tok.text = string(l.input[tok.pos-1 : l.pos])
+			return
+		case '\\':
+			if l.pos >= len(l.input) {
+				break
+			}
+			esc := l.input[l.pos]
+			l.pos++
+			switch esc {
+			case 'n':
+				sb.WriteRune('\n')
+			case 'r':
+				sb.WriteRune('\r')
+			case 't':
+				sb.WriteRune('\t')
+			case '\\', '"', '\'':
+				sb.WriteRune(esc)
+			default:
+				err = &SyntaxError{Pos: l.pos - 1, Msg: fmt.Sprintf("invalid escape sequence '\\%c'", esc)}
+				return
+			}
+		default:
+			sb.WriteRune(ch)
+		}
+	}
+	err = &SyntaxError{Pos: tok.pos, Msg: "unterminated string literal"}
+	return
+}
+
+// lexNumber reads a numeric literal. Integer literals are represented as int64 if they fit,
+// all other numbers are represented as float64.
+func (l *lexer) lexNumber() (tok token, err error) {
+	start := l.pos
+	tok.pos = start + 1
+	tok.kind = tokenNumber
+	for l.pos < len(l.input) && unicode.IsDigit(l.input[l.pos]) {
+		l.pos++
+	}
+	if l.pos+1 < len(l.input) && l.input[l.pos] == '.' && unicode.IsDigit(l.input[l.pos+1]) {
+		l.pos++
+		for l.pos < len(l.input) && unicode.IsDigit(l.input[l.pos]) {
+			l.pos++
+		}
+	}
+	if l.pos < len(l.input) && (l.input[l.pos] == 'e' || l.input[l.pos] == 'E') {
+		exp := l.pos + 1
+		if exp < len(l.input) && (l.input[exp] == '+' || l.input[exp] == '-') {
+			exp++
+		}
+		if exp < len(l.input) && unicode.IsDigit(l.input[exp]) {
+			l.pos = exp
+			for l.pos < len(l.input) && unicode.IsDigit(l.input[l.pos]) {
+				l.pos++
+			}
+		}
+	}
+	tok.text = string(l.input[start:l.pos])
+	if i, intErr := strconv.ParseInt(tok.text, 10, 64); intErr == nil {
+		tok.value = i
+		return
+	}
+	tok.value, err = strconv.ParseFloat(tok.text, 64)
+	if err != nil {
+		err = &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("invalid number %s", tok.text)}
+	}
+	return
+}
+
+// isIdentRune checks if the rune can be a part of an identifier.
+func isIdentRune(r rune) bool {
+	return r == '_' || r == '$' || unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// node is a node of the abstract syntax tree of an expression.
+type node interface {
+	// eval evaluates the node using the variables of the pipeline.
+	eval(pipeline *Pipeline) (any, error)
+	// position returns the 1-based position of the node in the expression.
+	position() int
+	// String returns the node in expression notation, used to name the operands in errors.
+	String() string
+}
+
+// literalNode is a constant value.
+type literalNode struct {
+	value any
+	pos   int
+}
+
+// listNode is an array literal such as [1, 2, 3].
+type listNode struct {
+	items []node
+	pos   int
+}
+
+// pathSegment is a segment of a variable path. Either name or index is set.
+type pathSegment struct {
+	name  string
+	index node
+}
+
+// pathNode is a reference to a variable in the pipeline such as order.items[0].qty.
+type pathNode struct {
+	root     string
+	segments []pathSegment
+	pos      int
+}
+
+// unaryNode is a prefix operator applied to an operand.
+type unaryNode struct {
+	op      string
+	operand node
+	pos     int
+}
+
+// binaryNode is an infix operator applied to two operands.
+// re holds the compiled pattern of the matches operator when the pattern is a string literal.
+type binaryNode struct {
+	op    string
+	left  node
+	right node
+	re    *regexp.Regexp
+	pos   int
+}
+
+func (n *literalNode) position() int { return n.pos }
+func (n *listNode) position() int    { return n.pos }
+func (n *pathNode) position() int    { return n.pos }
+func (n *unaryNode) position() int   { return n.pos }
+func (n *binaryNode) position() int  { return n.pos }
+
+// String returns the literal in expression notation.
+func (n *literalNode) String() string {
+	switch v := n.value.(type) {
+	case nil:
+		return "null"
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// String returns the array literal in expression notation.
+func (n *listNode) String() string {
+	items := make([]string, len(n.items))
+	for i, item := range n.items {
+		items[i] = item.String()
+	}
+	return "[" + strings.Join(items, ", ") + "]"
+}
+
+// String returns the path in dot and index notation.
+func (n *pathNode) String() string {
+	var sb strings.Builder
+	sb.WriteString(n.root)
+	for _, seg := range n.segments {
+		if seg.index != nil {
+			sb.WriteString("[" + seg.index.String() + "]")
+		} else {
+			sb.WriteString(".")
+			sb.WriteString(seg.name)
+		}
+	}
+	return sb.String()
+}
+
+// String returns the unary expression in expression notation.
+func (n *unaryNode) String() string {
+	return n.op + n.operand.String()
+}
+
+// String returns the binary expression in expression notation.
+func (n *binaryNode) String() string {
+	return "(" + n.left.String() + " " + n.op + " " + n.right.String() + ")"
+}
+
+// binaryPrecedence determines the precedence of the binary operators.
+// Operators with a higher precedence bind tighter.
+func binaryPrecedence(op string) int {
+	switch op {
+	case "||": // Logical OR has the lowest precedence
+		return 1
+	case "&&": // Logical AND has higher precedence than OR
+		return 2
+	case "==", "!=": // Equality operators
+		return 3
+	case "<", ">", "<=", ">=", "in", "contains", "matches", "=~": // Relational operators
+		return 4
+	case "+", "-": // Additive operators
+		return 5
+	case "*", "/", "%": // Multiplicative operators
+		return 6
+	default: // Not a binary operator
+		return -1
+	}
+}
+
+// parser is a precedence climbing parser for expressions.
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parse parses the expression into an abstract syntax tree.
+func parse(expression string) (root node, err error) {
+	var tokens []token
+	tokens, err = tokenize(expression)
+	if err != nil {
+		return
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokenEOF {
+		err = &SyntaxError{Pos: 1, Msg: "empty expression"}
+		return
+	}
+	root, err = p.parseBinary(1)
+	if err != nil {
+		return
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		err = &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q", tok.text)}
+	}
+	return
+}
+
+// peek returns the current token without consuming it.
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+// advance consumes and returns the current token.
+func (p *parser) advance() token {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// expect consumes the current token if it is of the given kind, otherwise it returns a SyntaxError.
+func (p *parser) expect(kind tokenKind, what string) (tok token, err error) {
+	tok = p.peek()
+	if tok.kind != kind {
+		err = unexpected(tok, what)
+		return
+	}
+	p.advance()
+	return
+}
+
+// unexpected creates a SyntaxError for an unexpected token.
+func unexpected(tok token, what string) error {
+	if tok.kind == tokenEOF {
+		return &SyntaxError{Pos: tok.pos, Msg: "unexpected end of expression, expected " + what}
+	}
+	return &SyntaxError{Pos: tok.pos, Msg: fmt.Sprintf("unexpected %q, expected %s", tok.text, what)}
+}
+
+// parseBinary parses binary operators with a precedence of at least minPrec.
+func (p *parser) parseBinary(minPrec int) (left node, err error) {
+	left, err = p.parseUnary()
+	if err != nil {
+		return
+	}
+	for {
+		tok := p.peek()
+		if tok.kind != tokenOperator && !(tok.kind == tokenIdent && keywordOperators[tok.text]) {
+			return
+		}
+		prec := binaryPrecedence(tok.text)
+		if prec < minPrec {
+			return
+		}
+		p.advance()
+		var right node
+		right, err = p.parseBinary(prec + 1)
+		if err != nil {
+			return
+		}
+		left = &binaryNode{op: tok.text, left: left, right: right, pos: tok.pos}
+	}
+}
+
+// parseUnary parses the prefix operators ! and -.
+func (p *parser) parseUnary() (n node, err error) {
+	tok := p.peek()
+	if tok.kind == tokenOperator && (tok.text == "!" || tok.text == "-") {
+		p.advance()
+		var operand node
+		operand, err = p.parseUnary()
+		if err != nil {
+			return
+		}
+		n = &unaryNode{op: tok.text, operand: operand, pos: tok.pos}
+		return
+	}
+	return p.parsePrimary()
+}
+
+// parsePrimary parses literals, parenthesised expressions, array literals and variable paths.
+func (p *parser) parsePrimary() (n node, err error) {
+	tok := p.advance()
+	switch tok.kind {
+	case tokenNumber, tokenString:
+		n = &literalNode{value: tok.value, pos: tok.pos}
+	case tokenLParen:
+		n, err = p.parseBinary(1)
+		if err != nil {
+			return
+		}
+		_, err = p.expect(tokenRParen, "')'")
+	case tokenLBracket:
+		list := &listNode{pos: tok.pos}
+		if p.peek().kind != tokenRBracket {
+			for {
+				var item node
+				item, err = p.parseBinary(1)
+				if err != nil {
+					return
+				}
+				list.items = append(list.items, item)
+				if p.peek().kind != tokenComma {
+					break
+				}
+				p.advance()
+			}
+		}
+		_, err = p.expect(tokenRBracket, "']'")
+		n = list
+	case tokenIdent:
+		switch tok.text {
+		case "true":
+			n = &literalNode{value: true, pos: tok.pos}
+		case "false":
+			n = &literalNode{value: false, pos: tok.pos}
+		case "null", "nil":
+			n = &literalNode{value: nil, pos: tok.pos}
+		default:
+			n, err = p.parsePath(tok)
+		}
+	default:
+		err = unexpected(tok, "a value")
+	}
+	return
+}
+
+// parsePath parses the dotted and indexed segments following the root identifier of a variable.
+func (p *parser) parsePath(root token) (n node, err error) {
+	path := &pathNode{root: root.text, pos: root.pos}
+	for {
+		switch p.peek().kind {
+		case tokenDot:
+			p.advance()
+			var name token
+			name, err = p.expect(tokenIdent, "a field name")
+			if err != nil {
+				return
+			}
+			path.segments = append(path.segments, pathSegment{name: name.text})
+		case tokenLBracket:
+			p.advance()
+			var index node
+			index, err = p.parseBinary(1)
+			if err != nil {
+				return
+			}
+			_, err = p.expect(tokenRBracket, "']'")
+			if err != nil {
+				return
+			}
+			path.segments = append(path.segments, pathSegment{index: index})
+		default:
+			n = path
+			return
+		}
+	}
+}
@@ -0,0 +1,319 @@
+package data
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"strings"
+)
+
+// eval returns the constant value of the literal.
+func (n *literalNode) eval(pipeline *Pipeline) (any, error) {
+	return n.value, nil
+}
+
+// eval evaluates each item of the array literal.
+func (n *listNode) eval(pipeline *Pipeline) (any, error) {
+	values := make([]any, len(n.items))
+	for i, item := range n.items {
+		v, err := item.eval(pipeline)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// eval resolves the variable from the pipeline and walks the segments of the path.
+func (n *pathNode) eval(pipeline *Pipeline) (value any, err error) {
+	value, err = pipeline.Get(n.root)
+	if err != nil {
+		err = fmt.Errorf("unknown variable %s at position %d: %w", n.root, n.pos, err)
+		return
+	}
+	for _, seg := range n.segments {
+		if seg.index == nil {
+			value, err = lookupKey(value, seg.name)
+		} else {
+			var index any
+			index, err = seg.index.eval(pipeline)
+			if err != nil {
+				return
+			}
+			value, err = lookupIndex(value, index)
+		}
+		if err != nil {
+			err = fmt.Errorf("unable to resolve %s at position %d: %w", n, n.pos, err)
+			return
+		}
+	}
+	return
+}
+
+// eval applies the prefix operator to the operand.
+func (n *unaryNode) eval(pipeline *Pipeline) (any, error) {
+	v, err := n.operand.eval(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "!":
+		b, ok := v.(bool)
+		if !ok {
+			return nil, n.mismatch(v)
+		}
+		return !b, nil
+	case "-":
+		f, ok := toNumber(v)
+		if !ok {
+			return nil, n.mismatch(v)
+		}
+		return -f, nil
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", n.op)
+	}
+}
+
+// eval applies the infix operator to the operands.
+// The logical operators && and || short-circuit and only evaluate the right operand if required.
+func (n *binaryNode) eval(pipeline *Pipeline) (any, error) {
+	left, err := n.left.eval(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	if n.op == "&&" || n.op == "||" {
+		l, ok := left.(bool)
+		if !ok {
+			return nil, &TypeMismatchError{Op: n.op, Pos: n.pos, Left: n.left.String(), LeftType: typeName(left)}
+		}
+		if (n.op == "&&" && !l) || (n.op == "||" && l) {
+			return l, nil
+		}
+		var right any
+		right, err = n.right.eval(pipeline)
+		if err != nil {
+			return nil, err
+		}
+		r, ok := right.(bool)
+		if !ok {
+			return nil, n.mismatch(left, right)
+		}
+		return r, nil
+	}
+	right, err := n.right.eval(pipeline)
+	if err != nil {
+		return nil, err
+	}
+	switch n.op {
+	case "==":
+		return Equal(left, right), nil
+	case "!=":
+		return !Equal(left, right), nil
+	case "<", ">", "<=", ">=":
+		return n.compare(left, right)
+	case "+", "-", "*", "/", "%":
+		return n.arithmetic(left, right)
+	case "in":
+		return n.contains(right, left)
+	case "contains":
+		return n.contains(left, right)
+	case "matches", "=~":
+		return n.matches(left, right)
+	default:
+		return nil, fmt.Errorf("unknown operator: %s", n.op)
+	}
+}
+
+// compare applies the relational operators to the operands.
+// See compareValues for the supported combinations of operand types.
+func (n *binaryNode) compare(left, right any) (bool, error) {
+	result, ok := compareValues(left, right)
+	if !ok {
+		return false, n.mismatch(left, right)
+	}
+	switch n.op {
+	case "<": // Less than
+		return result < 0, nil
+	case ">": // Greater than
+		return result > 0, nil
+	case "<=": // Less than or equal
+		return result <= 0, nil
+	default: // Greater than or equal
+		return result >= 0, nil
+	}
+}
+
+// mismatch creates a TypeMismatchError for the operands of the binary operator.
+func (n *binaryNode) mismatch(left, right any) error {
+	return &TypeMismatchError{
+		Op:        n.op,
+		Pos:       n.pos,
+		Left:      n.left.String(),
+		LeftType:  typeName(left),
+		Right:     n.right.String(),
+		RightType: typeName(right),
+	}
+}
+
+// mismatch creates a TypeMismatchError for the operand of the unary operator.
+func (n *unaryNode) mismatch(operand any) error {
+	return &TypeMismatchError{
+		Op:       n.op,
+		Pos:      n.pos,
+		Left:     n.operand.String(),
+		LeftType: typeName(operand),
+	}
+}
+
+// arithmetic applies the arithmetic operators to numeric operands.
+// The + operator concatenates the operands if either of them is a string.
+func (n *binaryNode) arithmetic(left, right any) (any, error) {
+	if n.op == "+" {
+		_, lStr := left.(string)
+		_, rStr := right.(string)
+		if lStr || rStr {
+			return fmt.Sprint(left) + fmt.Sprint(right), nil
+		}
+	}
+	a, okA := toNumber(left)
+	b, okB := toNumber(right)
+	if !okA || !okB {
+		return nil, n.mismatch(left, right)
+	}
+	switch n.op {
+	case "+":
+		return a + b, nil
+	case "-":
+		return a - b, nil
+	case "*":
+		return a * b, nil
+	case "/":
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero at position %d", n.pos)
+		}
+		return a / b, nil
+	default:
+		if b == 0 {
+			return nil, fmt.Errorf("division by zero at position %d", n.pos)
+		}
+		return math.Mod(a, b), nil
+	}
+}
+
+// contains checks if the container holds the element.
+// Arrays are searched for an equal item, maps are checked for the key and strings for the substring.
+// A *TypeMismatchError is returned if the container is of another type or the element cannot be
+// a substring of a string or a key of a map.
+func (n *binaryNode) contains(container, element any) (bool, error) {
+	mismatch := func() error {
+		// the operands of in are the element and the container
+		if n.op == "in" {
+			return n.mismatch(element, container)
+		}
+		return n.mismatch(container, element)
+	}
+	switch c := container.(type) {
+	case string:
+		s, ok := element.(string)
+		if !ok {
+			return false, mismatch()
+		}
+		return strings.Contains(c, s), nil
+	case []any:
+		for _, item := range c {
+			if Equal(item, element) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case map[string]any:
+		key, ok := element.(string)
+		if !ok {
+			return false, mismatch()
+		}
+		_, found := c[key]
+		return found, nil
+	}
+	rv := reflect.ValueOf(container)
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			if Equal(rv.Index(i).Interface(), element) {
+				return true, nil
+			}
+		}
+		return false, nil
+	case reflect.Map:
+		key := reflect.ValueOf(element)
+		if !key.IsValid() || !key.Type().AssignableTo(rv.Type().Key()) {
+			return false, mismatch()
+		}
+		return rv.MapIndex(key).IsValid(), nil
+	}
+	return false, mismatch()
+}
+
+// matches checks if the left operand matches the regular expression of the right operand.
+func (n *binaryNode) matches(left, right any) (bool, error) {
+	s, okS := left.(string)
+	pattern, okP := right.(string)
+	if !okS || !okP {
+		return false, n.mismatch(left, right)
+	}
+	re := n.re
+	if re == nil {
+		var err error
+		re, err = regexp.Compile(pattern)
+		if err != nil {
+			return false, fmt.Errorf("invalid regular expression at position %d: %w", n.right.position(), err)
+		}
+	}
+	return re.MatchString(s), nil
+}
+
+// lookupKey returns the value of the key in the map.
+func lookupKey(value any, key string) (any, error) {
+	if m, ok := value.(map[string]any); ok {
+		if v, found := m[key]; found {
+			return v, nil
+		}
+		return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Map && rv.Type().Key().Kind() == reflect.String {
+		v := rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key()))
+		if !v.IsValid() {
+			return nil, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+		}
+		return v.Interface(), nil
+	}
+	return nil, fmt.Errorf("cannot access field %s of %T", key, value)
+}
+
+// lookupIndex returns the element at the index of an array, or the value of the key of a map.
+func lookupIndex(value any, index any) (any, error) {
+	if key, ok := index.(string); ok {
+		return lookupKey(value, key)
+	}
+	f, ok := toNumber(index)
+	if !ok || f != math.Trunc(f) {
+		return nil, fmt.Errorf("invalid index %v", index)
+	}
+	i := int(f)
+	if arr, ok := value.([]any); ok {
+		if i < 0 || i >= len(arr) {
+			return nil, fmt.Errorf("%w: index %d out of range [0:%d]", ErrKeyNotFound, i, len(arr))
+		}
+		return arr[i], nil
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array {
+		if i < 0 || i >= rv.Len() {
+			return nil, fmt.Errorf("%w: index %d out of range [0:%d]", ErrKeyNotFound, i, rv.Len())
+		}
+		return rv.Index(i).Interface(), nil
+	}
+	return nil, fmt.Errorf("cannot index %T", value)
+}
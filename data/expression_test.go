@@ -0,0 +1,155 @@
+package data
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{expression: "a + b * 2", want: "(a + (b * 2))"},
+		{expression: "(a + b) * 2", want: "((a + b) * 2)"},
+		{expression: "!done && a < 3 || b", want: "((!done && (a < 3)) || b)"},
+		{expression: `status in ["NEW", 'OPEN']`, want: `(status in ["NEW", "OPEN"])`},
+		{expression: "order.items[i + 1].qty >= -1", want: "(order.items[(i + 1)].qty >= -1)"},
+		{expression: "x - 1", want: "(x - 1)"},
+		{expression: "x - 1", want: "(x - 1)"},
+		{expression: "items[0]-1", want: "(items[0] - 1)"},
+		// in, contains and matches are names unless they follow an operand
+		{expression: "in in contains", want: "(in in contains)"},
+		{expression: "matches.in contains order.matches", want: "(matches.in contains order.matches)"},
+		{expression: "contains > 1 && !in", want: "((contains > 1) && !in)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			root, err := parse(tt.expression)
+			if err != nil {
+				t.Fatalf("parse(%q) error = %v", tt.expression, err)
+			}
+			if got := root.String(); got != tt.want {
+				t.Fatalf("parse(%q) = %s, want %s", tt.expression, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		wantPos    int
+	}{
+		{expression: "", wantPos: 1},
+		{expression: "a = 1", wantPos: 3},
+		{expression: "a & b", wantPos: 3},
+		{expression: "a == ", wantPos: 6},
+		{expression: "(a == 1", wantPos: 8},
+		{expression: `a == "x`, wantPos: 6},
+		{expression: `a == "\q"`, wantPos: 7},
+		{expression: "a # b", wantPos: 3},
+		{expression: "a b", wantPos: 3},
+		{expression: "order-id == 1", wantPos: 6},
+		{expression: "a.b-c > 1", wantPos: 4},
+		{expression: "order-1 == 2", wantPos: 6},
+		{expression: "order-_id == 2", wantPos: 6},
+		{expression: "a in", wantPos: 5},
+		{expression: `a matches "("`, wantPos: 11},
+		{expression: "a matches 1", wantPos: 11},
+	}
+	for _, tt := range tests {
+		t.Run(tt.expression, func(t *testing.T) {
+			_, err := Compile(tt.expression)
+			var syntaxErr *SyntaxError
+			if !errors.As(err, &syntaxErr) {
+				t.Fatalf("Compile(%q) error = %v, want a *SyntaxError", tt.expression, err)
+			}
+			if syntaxErr.Pos != tt.wantPos {
+				t.Fatalf("Compile(%q) error = %v, want position %d", tt.expression, err, tt.wantPos)
+			}
+		})
+	}
+}
+
+func TestEvaluateCondition(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("status", "OPEN")
+	p.Set("count", 3)
+	p.Set("price", 2.5)
+	p.Set("email", "ops@nandlabs.io")
+	p.Set("tags", []string{"a", "b"})
+	p.Set("order", map[string]any{"items": []any{map[string]any{"qty": int64(4)}}})
+	p.Set("in", 1)
+	p.Set("contains", []any{"x"})
+	p.Set("done", false)
+	p.Set("nothing", nil)
+	tests := []struct {
+		condition string
+		want      bool
+	}{
+		{condition: `status == "OPEN"`, want: true},
+		{condition: `status == 'OPEN' && count > 2`, want: true},
+		{condition: "count + 1 == 4 && count * price == 7.5", want: true},
+		{condition: "count % 2 == 1 && count / 2 == 1.5", want: true},
+		{condition: "count - 1 == 2", want: true},
+		{condition: `status in ["NEW", "OPEN"]`, want: true},
+		{condition: `"c" in tags`, want: false},
+		{condition: `tags contains "b"`, want: true},
+		{condition: `email matches ".*@nandlabs\\.io$"`, want: true},
+		{condition: `email =~ "^dev"`, want: false},
+		{condition: "order.items[0].qty >= count", want: true},
+		{condition: "!done || missing", want: true},
+		{condition: "nothing == null", want: true},
+		{condition: "in == 1", want: true},
+		{condition: `"x" in contains`, want: true},
+		{condition: "-count < 0", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.condition, func(t *testing.T) {
+			got, err := p.EvaluateCondition(tt.condition)
+			if err != nil {
+				t.Fatalf("EvaluateCondition(%q) error = %v", tt.condition, err)
+			}
+			if got != tt.want {
+				t.Fatalf("EvaluateCondition(%q) = %v, want %v", tt.condition, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEvaluateConditionErrors(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("count", 3)
+	p.Set("name", "x")
+	for _, condition := range []string{
+		"count",
+		"count / 0 == 1",
+		"name > 1",
+		"count && true",
+		"count in 5",
+		"missing == null",
+	} {
+		if _, err := p.EvaluateCondition(condition); err == nil {
+			t.Errorf("EvaluateCondition(%q) succeeded, want an error", condition)
+		}
+	}
+	p.Set("labels", map[string]any{"a": 1})
+	p.Set("codes", map[int]string{1: "a"})
+	for _, condition := range []string{
+		"name - 1 == 0",
+		"count in 5",
+		"1 in name",
+		"name contains 1",
+		"1 in labels",
+		"labels contains 1",
+		"\"a\" in codes",
+		"count matches \"3\"",
+		"name =~ count",
+	} {
+		var mismatch *TypeMismatchError
+		if _, err := p.EvaluateCondition(condition); !errors.As(err, &mismatch) {
+			t.Errorf("EvaluateCondition(%q) error = %v, want a *TypeMismatchError", condition, err)
+		}
+	}
+}
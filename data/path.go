@@ -0,0 +1,332 @@
+package data
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// pathKey is a segment of a path in dot and index notation. Either key or index is used.
+type pathKey struct {
+	key     string
+	index   int
+	isIndex bool
+}
+
+// String returns the segment in dot and index notation.
+func (k pathKey) String() string {
+	if k.isIndex {
+		return "[" + strconv.Itoa(k.index) + "]"
+	}
+	return k.key
+}
+
+// parsePathKeys parses a path such as customer.address.zip, items[2].price or labels["app.kubernetes.io/name"].
+// The first segment of the path must be a key.
+func parsePathKeys(path string) (keys []pathKey, err error) {
+	runes := []rune(path)
+	pos := 0
+	readKey := func() string {
+		start := pos
+		for pos < len(runes) && runes[pos] != '.' && runes[pos] != '[' {
+			pos++
+		}
+		return string(runes[start:pos])
+	}
+	root := readKey()
+	if root == "" {
+		err = &SyntaxError{Pos: pos + 1, Msg: "path must start with a key"}
+		return
+	}
+	keys = append(keys, pathKey{key: root})
+	for pos < len(runes) {
+		switch runes[pos] {
+		case '.':
+			pos++
+			start := pos
+			key := readKey()
+			if key == "" {
+				err = &SyntaxError{Pos: start + 1, Msg: "missing key after '.'"}
+				return
+			}
+			keys = append(keys, pathKey{key: key})
+		case '[':
+			start := pos
+			pos++
+			end := pos
+			for end < len(runes) && runes[end] != ']' {
+				if runes[end] == '"' || runes[end] == '\'' {
+					quote := runes[end]
+					for end++; end < len(runes) && runes[end] != quote; end++ {
+					}
+				}
+				end++
+			}
+			if end >= len(runes) {
+				err = &SyntaxError{Pos: start + 1, Msg: "missing ']'"}
+				return
+			}
+			inner := strings.TrimSpace(string(runes[pos:end]))
+			pos = end + 1
+			if len(inner) >= 2 && (inner[0] == '"' || inner[0] == '\'') && inner[len(inner)-1] == inner[0] {
+				keys = append(keys, pathKey{key: inner[1 : len(inner)-1]})
+				continue
+			}
+			index, convErr := strconv.Atoi(inner)
+			if convErr != nil || index < 0 {
+				err = &SyntaxError{Pos: start + 2, Msg: fmt.Sprintf("invalid index %q", inner)}
+				return
+			}
+			keys = append(keys, pathKey{index: index, isIndex: true})
+		default:
+			err = &SyntaxError{Pos: pos + 1, Msg: fmt.Sprintf("unexpected '%c'", runes[pos])}
+			return
+		}
+	}
+	return
+}
+
+// GetPath retrieves the value at the given path from the Pipeline.
+// The path uses dot notation for the keys of nested maps and index notation for the
+// elements of arrays, e.g. customer.address.zip or items[2].price. Keys containing dots
+// can be quoted in index notation, e.g. labels["app.kubernetes.io/name"].
+//
+// Parameters:
+//   - path: The path of the value to look up.
+//
+// Returns:
+//   - value: The value at the path, if found.
+//   - err: A *SyntaxError if the path is invalid, an error wrapping ErrKeyNotFound if
+//     any segment of the path does not exist, otherwise nil.
+func (p *Pipeline) GetPath(path string) (value any, err error) {
+	var keys []pathKey
+	keys, err = parsePathKeys(path)
+	if err != nil {
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	value, ok := p.lookup(keys[0].key)
+	if !ok {
+		err = fmt.Errorf("%w: %s", ErrKeyNotFound, keys[0].key)
+		return
+	}
+	for _, k := range keys[1:] {
+		if k.isIndex {
+			value, err = lookupIndex(value, k.index)
+		} else {
+			value, err = lookupKey(value, k.key)
+		}
+		if err != nil {
+			err = fmt.Errorf("unable to resolve %s: %w", path, err)
+			return
+		}
+	}
+	return
+}
+
+// HasPath checks if a value exists at the given path in the Pipeline.
+func (p *Pipeline) HasPath(path string) bool {
+	_, err := p.GetPath(path)
+	return err == nil
+}
+
+// SetPath assigns the value at the given path in the Pipeline, see GetPath for the path notation.
+// Missing intermediate maps and arrays are created on demand. Setting the index equal to the
+// length of an array appends the value, indexes past the end of an array are rejected.
+// The maps and arrays along the path are copied before they are modified, so snapshots of
+// the pipeline and values shared with other pipelines are never changed.
+//
+// Parameters:
+//   - path: The path at which the value is set.
+//   - value: The value to be set.
+//
+// Returns:
+//
+//	A *SyntaxError if the path is invalid, an error wrapping ErrIndexOutOfRange if an index is past the end
+//	of its array, an error if an intermediate value is neither a map nor an array, otherwise nil.
+func (p *Pipeline) SetPath(path string, value any) (err error) {
+	var keys []pathKey
+	keys, err = parsePathKeys(path)
+	if err != nil {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current, _ := p.lookup(keys[0].key)
+	current, err = setIn(current, keys[1:], value)
+	if err != nil {
+		err = fmt.Errorf("unable to set %s: %w", path, err)
+		return
+	}
+	p.set(keys[0].key, current)
+	return
+}
+
+// DeletePath removes the value at the given path from the Pipeline, see GetPath for the path notation.
+// Deleting an array element removes it from the array. The maps and arrays along the path are
+// copied before they are modified. If the path does not exist, the function does nothing and returns nil.
+//
+// Parameters:
+//   - path: The path of the value to be deleted.
+//
+// Returns:
+//
+//	A *SyntaxError if the path is invalid, an error if an intermediate value is neither a map nor an array, otherwise nil.
+func (p *Pipeline) DeletePath(path string) (err error) {
+	var keys []pathKey
+	keys, err = parsePathKeys(path)
+	if err != nil {
+		return
+	}
+	if len(keys) == 1 {
+		return p.Delete(keys[0].key)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	current, ok := p.lookup(keys[0].key)
+	if !ok {
+		return
+	}
+	var changed bool
+	current, changed, err = deleteIn(current, keys[1:])
+	if err != nil {
+		err = fmt.Errorf("unable to delete %s: %w", path, err)
+		return
+	}
+	if changed {
+		p.set(keys[0].key, current)
+	}
+	return
+}
+
+// ExtractPath retrieves a value of type T from the Pipeline at the provided path.
+// If the value is not of type T, it returns an ErrInvalidType error.
+//
+// Parameters:
+//   - c: A pointer to the Pipeline from which to extract the value.
+//   - path: The path of the value to be retrieved, see Pipeline.GetPath.
+//
+// Returns:
+//   - value: The value of type T at the provided path.
+//   - err: An error if the path does not exist or the value is not of type T.
+func ExtractPath[T any](c *Pipeline, path string) (value T, err error) {
+	var v any
+	v, err = c.GetPath(path)
+	if err != nil {
+		return
+	}
+	if t, ok := v.(T); ok {
+		value = t
+	} else {
+		err = ErrInvalidType
+	}
+	return
+}
+
+// setIn returns a copy of current with the value set at the keys.
+// A nil current is replaced by a new map or array depending on the first key,
+// an index equal to the length of an array appends to it.
+func setIn(current any, keys []pathKey, value any) (any, error) {
+	if len(keys) == 0 {
+		return value, nil
+	}
+	k := keys[0]
+	if k.isIndex {
+		var arr []any
+		switch c := current.(type) {
+		case nil:
+		case []any:
+			arr = c
+		default:
+			return nil, fmt.Errorf("cannot set index %d on %T", k.index, current)
+		}
+		size := len(arr)
+		if k.index > size {
+			return nil, fmt.Errorf("%w: index %d past the end of the array of length %d", ErrIndexOutOfRange, k.index, size)
+		} else if k.index == size {
+			size++
+		}
+		copied := make([]any, size)
+		copy(copied, arr)
+		child, err := setIn(copied[k.index], keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		copied[k.index] = child
+		return copied, nil
+	}
+	var m map[string]any
+	switch c := current.(type) {
+	case nil:
+	case map[string]any:
+		m = c
+	default:
+		return nil, fmt.Errorf("cannot set key %s on %T", k.key, current)
+	}
+	copied := make(map[string]any, len(m)+1)
+	for key, val := range m {
+		copied[key] = val
+	}
+	child, err := setIn(copied[k.key], keys[1:], value)
+	if err != nil {
+		return nil, err
+	}
+	copied[k.key] = child
+	return copied, nil
+}
+
+// deleteIn returns a copy of current with the value at the keys removed.
+// changed is false if the keys do not exist in current.
+func deleteIn(current any, keys []pathKey) (result any, changed bool, err error) {
+	k := keys[0]
+	last := len(keys) == 1
+	switch c := current.(type) {
+	case []any:
+		if !k.isIndex {
+			return nil, false, fmt.Errorf("cannot delete key %s from %T", k.key, current)
+		}
+		if k.index >= len(c) {
+			return current, false, nil
+		}
+		copied := make([]any, len(c))
+		copy(copied, c)
+		if last {
+			return append(copied[:k.index], copied[k.index+1:]...), true, nil
+		}
+		var child any
+		child, changed, err = deleteIn(copied[k.index], keys[1:])
+		if err != nil || !changed {
+			return current, changed, err
+		}
+		copied[k.index] = child
+		return copied, true, nil
+	case map[string]any:
+		if k.isIndex {
+			return nil, false, fmt.Errorf("cannot delete index %d from %T", k.index, current)
+		}
+		val, ok := c[k.key]
+		if !ok {
+			return current, false, nil
+		}
+		copied := make(map[string]any, len(c))
+		for key, v := range c {
+			copied[key] = v
+		}
+		if last {
+			delete(copied, k.key)
+			return copied, true, nil
+		}
+		var child any
+		child, changed, err = deleteIn(val, keys[1:])
+		if err != nil || !changed {
+			return current, changed, err
+		}
+		copied[k.key] = child
+		return copied, true, nil
+	case nil:
+		return current, false, nil
+	default:
+		return nil, false, fmt.Errorf("cannot delete %s from %T", k, current)
+	}
+}
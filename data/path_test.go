@@ -0,0 +1,144 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParsePathKeys(t *testing.T) {
+	tests := []struct {
+		path    string
+		want    []pathKey
+		wantErr bool
+	}{
+		{path: "a", want: []pathKey{{key: "a"}}},
+		{path: "a.b[2].c", want: []pathKey{{key: "a"}, {key: "b"}, {index: 2, isIndex: true}, {key: "c"}}},
+		{path: `labels["app.kubernetes.io/name"]`, want: []pathKey{{key: "labels"}, {key: "app.kubernetes.io/name"}}},
+		{path: "labels['a]b']", want: []pathKey{{key: "labels"}, {key: "a]b"}}},
+		{path: "", wantErr: true},
+		{path: "[0]", wantErr: true},
+		{path: "a.", wantErr: true},
+		{path: "a[", wantErr: true},
+		{path: "a[-1]", wantErr: true},
+		{path: "a[x]", wantErr: true},
+		{path: "a[0]b", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := parsePathKeys(tt.path)
+			if tt.wantErr {
+				var syntaxErr *SyntaxError
+				if !errors.As(err, &syntaxErr) {
+					t.Fatalf("parsePathKeys(%q) error = %v, want a *SyntaxError", tt.path, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("parsePathKeys(%q) = %v, %v, want %v", tt.path, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestGetPath(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("order", map[string]any{
+		"items":  []any{map[string]any{"price": 10}, map[string]any{"price": 20}},
+		"labels": map[string]any{"app.kubernetes.io/name": "shop"},
+	})
+	tests := []struct {
+		path    string
+		want    any
+		wantErr error
+	}{
+		{path: "order.items[1].price", want: 20},
+		{path: `order.labels["app.kubernetes.io/name"]`, want: "shop"},
+		{path: "order.items[2]", wantErr: ErrKeyNotFound},
+		{path: "order.missing", wantErr: ErrKeyNotFound},
+		{path: "missing.a", wantErr: ErrKeyNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := p.GetPath(tt.path)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("GetPath(%q) error = %v, want %v", tt.path, err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("GetPath(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+	if price, err := ExtractPath[int](p, "order.items[0].price"); err != nil || price != 10 {
+		t.Fatalf("ExtractPath() = %v, %v", price, err)
+	}
+	if _, err := ExtractPath[string](p, "order.items[0].price"); !errors.Is(err, ErrInvalidType) {
+		t.Fatalf("ExtractPath() error = %v, want %v", err, ErrInvalidType)
+	}
+}
+
+func TestSetPath(t *testing.T) {
+	items := []any{"a"}
+	p := NewPipeline("id")
+	p.Set("items", items)
+	snapshot := p.Snapshot()
+
+	if err := p.SetPath("items[1]", "b"); err != nil {
+		t.Fatalf("SetPath() appending error = %v", err)
+	}
+	if err := p.SetPath("items[0]", "z"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.SetPath("items[5]", "c"); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("SetPath() past the end error = %v, want %v", err, ErrIndexOutOfRange)
+	}
+	if err := p.SetPath("customer.tags[0].name", "vip"); err != nil {
+		t.Fatalf("SetPath() creating the path error = %v", err)
+	}
+	if err := p.SetPath("customer.tags[1000000000]", "x"); !errors.Is(err, ErrIndexOutOfRange) {
+		t.Fatalf("SetPath() with a huge index error = %v, want %v", err, ErrIndexOutOfRange)
+	}
+	if err := p.SetPath("items[0].name", "x"); err == nil {
+		t.Fatal("SetPath() set a key on a string")
+	}
+
+	if got, _ := p.Get("items"); !reflect.DeepEqual(got, []any{"z", "b"}) {
+		t.Fatalf("items = %v, want [z b]", got)
+	}
+	if got, _ := p.GetPath("customer.tags[0].name"); got != "vip" {
+		t.Fatalf("customer.tags[0].name = %v, want vip", got)
+	}
+	if !reflect.DeepEqual(items, []any{"a"}) {
+		t.Fatalf("SetPath() modified the shared array: %v", items)
+	}
+	if got, _ := snapshot.Get("items"); !reflect.DeepEqual(got, []any{"a"}) {
+		t.Fatalf("SetPath() modified the snapshot: %v", got)
+	}
+}
+
+func TestDeletePath(t *testing.T) {
+	order := map[string]any{"items": []any{"a", "b", "c"}, "note": "x"}
+	p := NewPipeline("id")
+	p.Set("order", order)
+	if err := p.DeletePath("order.items[1]"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DeletePath("order.note"); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.DeletePath("order.missing.key"); err != nil {
+		t.Fatalf("DeletePath() of a missing path error = %v", err)
+	}
+	if err := p.DeletePath("order.items.key"); err == nil {
+		t.Fatal("DeletePath() deleted a key from an array")
+	}
+	if got, _ := p.Get("order"); !reflect.DeepEqual(got, map[string]any{"items": []any{"a", "c"}}) {
+		t.Fatalf("order = %v", got)
+	}
+	if len(order) != 2 || len(order["items"].([]any)) != 3 {
+		t.Fatalf("DeletePath() modified the shared map: %v", order)
+	}
+	if err := p.DeletePath("order"); err != nil || p.Has("order") {
+		t.Fatalf("DeletePath() of a root key error = %v", err)
+	}
+}
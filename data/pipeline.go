@@ -2,15 +2,16 @@ package data
 
 import (
 	"errors"
-	"fmt"
-	"strconv"
-	"strings"
+	"sort"
+	"sync"
 
 	"oss.nandlabs.io/orcaloop-sdk/models"
 )
 
 var ErrInvalidType = errors.New("invalid type")
 var ErrKeyNotFound = errors.New("key not found")
+var ErrNotOverlay = errors.New("pipeline is not an overlay")
+var ErrIndexOutOfRange = errors.New("index out of range")
 
 // Pipeline is a struct that represents a workflow context
 
@@ -28,8 +29,21 @@ const (
 
 // Pipeline represents a pipeline that processes data stored in a map.
 // The data is stored as key-value pairs where the key is a string and the value can be of any type.
+//
+// A Pipeline is safe for concurrent use. Snapshot returns an immutable view of the pipeline
+// that shares its data until the pipeline is modified next (copy-on-write). An overlay created
+// from a Snapshot reads through to the snapshot and keeps its own writes and deletes, which can
+// be merged back into a pipeline using Join.
 type Pipeline struct {
+	mu sync.RWMutex
+	// data holds the values set on the pipeline.
 	data map[string]any
+	// shared is set when data is referenced by a Snapshot and must be copied before it is modified.
+	shared bool
+	// base is the snapshot read through by an overlay, nil for a regular pipeline.
+	base *Snapshot
+	// deleted holds the keys of the base that were deleted in an overlay.
+	deleted map[string]struct{}
 }
 
 // ExtractValue retrieves a value of type T from the Pipeline using the provided key.
@@ -138,8 +152,9 @@ func (p *Pipeline) Id() (id string) {
 //   - value: The value associated with the key, if found.
 //   - err: An error indicating whether the key was found or not.
 func (p *Pipeline) Get(key string) (value any, err error) {
-
-	if v, ok := p.data[key]; ok {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if v, ok := p.lookup(key); ok {
 		value = v
 	} else {
 		err = ErrKeyNotFound
@@ -147,6 +162,19 @@ func (p *Pipeline) Get(key string) (value any, err error) {
 	return
 }
 
+// lookup returns the value of the key from the data of the pipeline, or from the base of an overlay.
+// The caller must hold the lock of the pipeline.
+func (p *Pipeline) lookup(key string) (value any, ok bool) {
+	if value, ok = p.data[key]; ok || p.base == nil {
+		return
+	}
+	if _, deleted := p.deleted[key]; deleted {
+		return
+	}
+	value, ok = p.base.data[key]
+	return
+}
+
 // Has checks if the given key exists in the Pipeline's data map.
 // It returns true if the key is present, otherwise false.
 //
@@ -158,14 +186,25 @@ func (p *Pipeline) Get(key string) (value any, err error) {
 //
 //	bool - true if the key exists, false otherwise.
 func (p *Pipeline) Has(key string) bool {
-	_, ok := p.data[key]
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	_, ok := p.lookup(key)
 	return ok
 }
 
 // Keys returns a slice of all the keys present in the Pipeline's data.
 // It iterates over the map and collects each key into a slice, which is then returned.
 func (p *Pipeline) Keys() []string {
-
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.base != nil {
+		values := p.flatten()
+		keys := make([]string, 0, len(values))
+		for k := range values {
+			keys = append(keys, k)
+		}
+		return keys
+	}
 	keys := make([]string, 0, len(p.data))
 	for k := range p.data {
 		keys = append(keys, k)
@@ -185,9 +224,31 @@ func (p *Pipeline) Keys() []string {
 //
 //	An error if the operation fails, otherwise nil.
 func (p *Pipeline) Set(key string, value any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.set(key, value)
+	return nil
+}
 
+// set assigns the value to the key. The caller must hold the write lock of the pipeline.
+func (p *Pipeline) set(key string, value any) {
+	p.ensureWritable()
 	p.data[key] = value
-	return nil
+	delete(p.deleted, key)
+}
+
+// ensureWritable copies the data of the pipeline if it is shared with a Snapshot.
+// The caller must hold the write lock of the pipeline.
+func (p *Pipeline) ensureWritable() {
+	if !p.shared {
+		return
+	}
+	data := make(map[string]any, len(p.data))
+	for k, v := range p.data {
+		data[k] = v
+	}
+	p.data = data
+	p.shared = false
 }
 
 // Delete removes the entry with the specified key from the Pipeline's data.
@@ -201,7 +262,15 @@ func (p *Pipeline) Set(key string, value any) error {
 //
 //	An error if the deletion fails, otherwise nil.
 func (p *Pipeline) Delete(key string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ensureWritable()
 	delete(p.data, key)
+	if p.base != nil {
+		if _, ok := p.base.data[key]; ok {
+			p.deleted[key] = struct{}{}
+		}
+	}
 	return nil
 }
 
@@ -209,7 +278,25 @@ func (p *Pipeline) Delete(key string) error {
 // Pipeline's internal data. The returned map has keys of type string and
 // values of type any.
 func (p *Pipeline) Map() map[string]any {
-	data := make(map[string]any, len(p.data))
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.flatten()
+}
+
+// flatten returns a new map holding all the values visible through the pipeline.
+// The caller must hold the lock of the pipeline.
+func (p *Pipeline) flatten() map[string]any {
+	var data map[string]any
+	if p.base != nil {
+		data = make(map[string]any, len(p.base.data)+len(p.data))
+		for k, v := range p.base.data {
+			if _, deleted := p.deleted[k]; !deleted {
+				data[k] = v
+			}
+		}
+	} else {
+		data = make(map[string]any, len(p.data))
+	}
 	for k, v := range p.data {
 		data[k] = v
 	}
@@ -267,8 +354,10 @@ func (p *Pipeline) SetError(errMsg string) {
 //
 //	An error if the merge operation fails, otherwise nil.
 func (p *Pipeline) MergeFrom(data map[string]any) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
 	for k, v := range data {
-		p.data[k] = v
+		p.set(k, v)
 	}
 	return nil
 }
@@ -282,22 +371,157 @@ func (p *Pipeline) MergeFrom(data map[string]any) error {
 //
 //	An error if the merge operation fails, otherwise nil.
 func (p *Pipeline) Merge(pipeline *Pipeline) error {
-	for k, v := range pipeline.data {
-		p.data[k] = v
-	}
-	return nil
+	return p.MergeFrom(pipeline.Map())
 }
 
-// Clone creates a deep copy of the current Pipeline instance.
+// Clone creates a copy of the current Pipeline instance.
 // It returns a new Pipeline instance with a duplicated map containing
 // the same key-value pairs as the original Pipeline.
+// Cloning an overlay returns a regular pipeline holding all the values visible through the overlay.
 func (p *Pipeline) Clone() *Pipeline {
-	data := make(map[string]any, len(p.data))
+	return &Pipeline{
+		data: p.Map(),
+	}
+}
+
+// Snapshot returns an immutable view of the current state of the pipeline.
+// The snapshot of a regular pipeline shares its data with the pipeline, which copies the
+// data the next time it is modified. Values are not copied deeply and must not be mutated
+// in place once they are set on a pipeline.
+//
+// Returns:
+//   - *Snapshot: The snapshot of the pipeline.
+func (p *Pipeline) Snapshot() *Snapshot {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.base != nil {
+		return &Snapshot{data: p.flatten()}
+	}
+	p.shared = true
+	return &Snapshot{data: p.data}
+}
+
+// IsOverlay checks if the pipeline is an overlay created using Snapshot.Overlay.
+func (p *Pipeline) IsOverlay() bool {
+	return p.base != nil
+}
+
+// Changes returns the values set on the overlay and the keys of the snapshot deleted
+// from it. The deleted keys are sorted.
+// It returns ErrNotOverlay if the pipeline is not an overlay.
+func (p *Pipeline) Changes() (set map[string]any, deleted []string, err error) {
+	if p.base == nil {
+		err = ErrNotOverlay
+		return
+	}
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	set = make(map[string]any, len(p.data))
 	for k, v := range p.data {
+		set[k] = v
+	}
+	deleted = make([]string, 0, len(p.deleted))
+	for k := range p.deleted {
+		deleted = append(deleted, k)
+	}
+	sort.Strings(deleted)
+	return
+}
+
+// Join merges the changes of the overlays into the pipeline. The overlays are merged
+// in the order they are given, so when several overlays change the same key the last
+// one wins regardless of the order in which they were modified.
+//
+// Parameters:
+//   - overlays: The overlays to be merged into the pipeline.
+//
+// Returns:
+//
+//	ErrNotOverlay if any of the pipelines is not an overlay, otherwise nil.
+func (p *Pipeline) Join(overlays ...*Pipeline) error {
+	type change struct {
+		set     map[string]any
+		deleted []string
+	}
+	changes := make([]change, len(overlays))
+	for i, overlay := range overlays {
+		set, deleted, err := overlay.Changes()
+		if err != nil {
+			return err
+		}
+		changes[i] = change{set: set, deleted: deleted}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.ensureWritable()
+	for _, c := range changes {
+		for _, k := range c.deleted {
+			delete(p.data, k)
+			if p.base != nil {
+				if _, ok := p.base.data[k]; ok {
+					p.deleted[k] = struct{}{}
+				}
+			}
+		}
+		for k, v := range c.set {
+			p.set(k, v)
+		}
+	}
+	return nil
+}
+
+// Snapshot is an immutable view of the data of a Pipeline at the time the snapshot was taken.
+// It is safe for concurrent use.
+type Snapshot struct {
+	data map[string]any
+}
+
+// Get retrieves the value associated with the given key from the Snapshot.
+// If the key is not found, an ErrKeyNotFound error is returned.
+func (s *Snapshot) Get(key string) (value any, err error) {
+	if v, ok := s.data[key]; ok {
+		value = v
+	} else {
+		err = ErrKeyNotFound
+	}
+	return
+}
+
+// Has checks if the given key exists in the Snapshot.
+func (s *Snapshot) Has(key string) bool {
+	_, ok := s.data[key]
+	return ok
+}
+
+// Keys returns a slice of all the keys present in the Snapshot.
+func (s *Snapshot) Keys() []string {
+	keys := make([]string, 0, len(s.data))
+	for k := range s.data {
+		keys = append(keys, k)
+	}
+	return keys
+}
+
+// Map returns a new map with the same key-value pairs as the Snapshot.
+func (s *Snapshot) Map() map[string]any {
+	data := make(map[string]any, len(s.data))
+	for k, v := range s.data {
 		data[k] = v
 	}
+	return data
+}
+
+// Overlay creates a new pipeline that reads through to the snapshot.
+// Values set on the overlay and keys deleted from it are kept in the overlay and
+// never modify the snapshot. The changes can be merged into a pipeline using Pipeline.Join.
+//
+// Returns:
+//   - *Pipeline: A new overlay on top of the snapshot.
+func (s *Snapshot) Overlay() *Pipeline {
 	return &Pipeline{
-		data: data,
+		data:    make(map[string]any),
+		base:    s,
+		deleted: make(map[string]struct{}),
 	}
 }
 
@@ -335,207 +559,26 @@ func (p *Pipeline) GetStatus() (status models.Status) {
 
 }
 
-// evaluateCondition evaluates a condition string using variables from the context.
-// It supports basic comparison and logical operators: ==, !=, <, >, <=, >=, &&, ||.
+// EvaluateCondition evaluates a condition string using variables from the pipeline.
+// The condition must evaluate to a boolean. It supports
+//   - logical operators: &&, || and the unary !
+//   - comparison operators: ==, !=, <, >, <=, >=
+//   - arithmetic operators: +, -, *, / and %
+//   - membership operators: in and contains, e.g. `status in ["NEW", "OPEN"]`
+//   - regular expression match: matches or =~, e.g. `email matches ".*@nandlabs.io"`
+//   - literals: numbers, single or double quoted strings, true, false and null
+//   - variable paths in dot and index notation, e.g. `order.items[0].qty`
+//
+// in, contains and matches are operators only when they follow an operand, elsewhere they are
+// variable or field names. Conditions cannot reference variables whose names contain '-': a '-'
+// directly between a name and a name or digit, such as `order-id` or `order-1`, is a *SyntaxError
+// and subtractions of variables are written with spaces, e.g. `a - b`.
+// Conditions are compiled once and cached in the DefaultExprCache, see CompileCondition.
+// A *SyntaxError holding the position of the offending character is returned if the condition cannot be parsed.
 func (p *Pipeline) EvaluateCondition(condition string) (bool, error) {
-	// Tokenize the input condition string into smaller parts (e.g., variables, operators).
-	tokens := tokenize(condition)
-
-	// Convert the infix tokens (e.g., "a == b && c") into postfix notation (Reverse Polish Notation).
-	postfix, err := infixToPostfix(tokens)
+	expr, err := CompileCondition(condition)
 	if err != nil {
 		return false, err
 	}
-
-	// Evaluate the postfix expression using the workflow context.
-	return evaluatePostfix(postfix, p)
-}
-
-// tokenize splits the condition string into tokens for parsing.
-func tokenize(condition string) []string {
-	var tokens []string
-	var currentToken strings.Builder
-
-	// Check if a character is part of an operator
-	isOperator := func(r rune) bool {
-		return strings.ContainsRune("!=<>&|()", r)
-	}
-
-	// Iterate through each character in the condition
-	for _, ch := range condition {
-		switch {
-		case ch == ' ': // Skip spaces
-			if currentToken.Len() > 0 {
-				tokens = append(tokens, currentToken.String())
-				currentToken.Reset()
-			}
-		case isOperator(ch): // If the character is an operator, split the token
-			if currentToken.Len() > 0 {
-				tokens = append(tokens, currentToken.String())
-				currentToken.Reset()
-			}
-			tokens = append(tokens, string(ch))
-		default: // Add characters to the current token
-			currentToken.WriteRune(ch)
-		}
-	}
-	// Append the last token, if any
-	if currentToken.Len() > 0 {
-		tokens = append(tokens, currentToken.String())
-	}
-	return tokens
-}
-
-// precedence determines the precedence of operators.
-func precedence(op string) int {
-	switch op {
-	case "||": // Logical OR has the lowest precedence
-		return 1
-	case "&&": // Logical AND has higher precedence than OR
-		return 2
-	case "==", "!=", "<", ">", "<=", ">=": // Comparison operators
-		return 3
-	case "(": // Parentheses have no precedence themselves
-		return 0
-	default: // Unknown operators
-		return -1
-	}
-}
-
-// infixToPostfix converts an infix expression (e.g., "a == b && c") to postfix (Reverse Polish Notation).
-func infixToPostfix(tokens []string) ([]string, error) {
-	var postfix []string
-	var stack []string
-
-	// Process each token
-	for _, token := range tokens {
-		switch token {
-		case "&&", "||", "==", "!=", "<", ">", "<=", ">=": // If the token is an operator
-			// Pop higher or equal precedence operators from the stack to postfix
-			for len(stack) > 0 && precedence(stack[len(stack)-1]) >= precedence(token) {
-				postfix = append(postfix, stack[len(stack)-1])
-				stack = stack[:len(stack)-1]
-			}
-			stack = append(stack, token) // Push the current operator onto the stack
-		case "(": // Push opening parentheses onto the stack
-			stack = append(stack, token)
-		case ")": // Process closing parentheses
-			// Pop from the stack until an opening parenthesis is encountered
-			for len(stack) > 0 && stack[len(stack)-1] != "(" {
-				postfix = append(postfix, stack[len(stack)-1])
-				stack = stack[:len(stack)-1]
-			}
-			// Check for mismatched parentheses
-			if len(stack) == 0 {
-				return nil, errors.New("mismatched parentheses")
-			}
-			stack = stack[:len(stack)-1] // Pop the opening parenthesis
-		default: // Otherwise, it's an operand (variable or literal)
-			postfix = append(postfix, token)
-		}
-	}
-
-	// Pop any remaining operators from the stack
-	for len(stack) > 0 {
-		if stack[len(stack)-1] == "(" {
-			return nil, errors.New("mismatched parentheses")
-		}
-		postfix = append(postfix, stack[len(stack)-1])
-		stack = stack[:len(stack)-1]
-	}
-
-	return postfix, nil
-}
-
-// evaluatePostfix evaluates a postfix expression using the context.
-func evaluatePostfix(postfix []string, pipeline *Pipeline) (bool, error) {
-	var stack []any
-
-	// Helper function to compare two operands with an operator
-	compare := func(a, b any, op string) (bool, error) {
-		switch op {
-		case "==": // Equality
-			return a == b, nil
-		case "!=": // Inequality
-			return a != b, nil
-		case "<": // Less than
-			return a.(float64) < b.(float64), nil
-		case ">": // Greater than
-			return a.(float64) > b.(float64), nil
-		case "<=": // Less than or equal
-			return a.(float64) <= b.(float64), nil
-		case ">=": // Greater than or equal
-			return a.(float64) >= b.(float64), nil
-		default:
-			return false, fmt.Errorf("unknown operator: %s", op)
-		}
-	}
-
-	// Process each token in the postfix expression
-	for _, token := range postfix {
-		switch token {
-		case "&&", "||": // Logical operators
-			if len(stack) < 2 {
-				return false, errors.New("invalid logical expression")
-			}
-			// Pop two operands
-			b := stack[len(stack)-1].(bool)
-			a := stack[len(stack)-2].(bool)
-			stack = stack[:len(stack)-2]
-
-			// Perform the logical operation
-			if token == "&&" {
-				stack = append(stack, a && b)
-			} else {
-				stack = append(stack, a || b)
-			}
-		case "==", "!=", "<", ">", "<=", ">=": // Comparison operators
-			if len(stack) < 2 {
-				return false, errors.New("invalid comparison expression")
-			}
-			// Pop two operands
-			b := stack[len(stack)-1]
-			a := stack[len(stack)-2]
-			stack = stack[:len(stack)-2]
-
-			// Perform the comparison
-			result, err := compare(a, b, token)
-			if err != nil {
-				return false, err
-			}
-			stack = append(stack, result)
-		default: // Operands (variables or literals)
-			value, err := parseToken(token, pipeline)
-			if err != nil {
-				return false, err
-			}
-			stack = append(stack, value)
-		}
-	}
-
-	// There should be exactly one result left on the stack
-	if len(stack) != 1 {
-		return false, errors.New("invalid postfix expression")
-	}
-	return stack[0].(bool), nil
-}
-
-// parseToken converts a token into a value using the context.
-func parseToken(token string, pipeline *Pipeline) (any, error) {
-	// If the token is a string literal (surrounded by quotes)
-	if strings.HasPrefix(token, `"`) && strings.HasSuffix(token, `"`) {
-		return token[1 : len(token)-1], nil
-	}
-
-	// If the token is a number, parse it
-	if value, err := strconv.ParseFloat(token, 64); err == nil {
-		return value, nil
-	}
-
-	// Otherwise, assume it's a variable in the context
-	if pipeline.Has(token) {
-		return pipeline.Get(token)
-	}
-
-	return nil, fmt.Errorf("unknown variable or value: %s", token)
+	return expr.Evaluate(p)
 }
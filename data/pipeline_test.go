@@ -0,0 +1,143 @@
+package data
+
+import (
+	"errors"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+)
+
+func sortedKeys(keys []string) []string {
+	sort.Strings(keys)
+	return keys
+}
+
+func TestSnapshotIsolation(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("a", 1)
+	p.Set("b", 2)
+	snapshot := p.Snapshot()
+
+	p.Set("a", 10)
+	p.Delete("b")
+	p.Set("c", 3)
+	if v, _ := snapshot.Get("a"); v != 1 {
+		t.Fatalf("snapshot a = %v, want 1", v)
+	}
+	if !snapshot.Has("b") || snapshot.Has("c") {
+		t.Fatalf("snapshot keys = %v, want the keys at the time of the snapshot", snapshot.Keys())
+	}
+	if _, err := snapshot.Get("c"); !errors.Is(err, ErrKeyNotFound) {
+		t.Fatalf("snapshot Get(c) error = %v", err)
+	}
+	m := snapshot.Map()
+	m["a"] = 100
+	if v, _ := snapshot.Get("a"); v != 1 {
+		t.Fatal("modifying the map of the snapshot changed the snapshot")
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("a", 1)
+	p.Set("b", 2)
+	overlay := p.Snapshot().Overlay()
+	if !overlay.IsOverlay() || p.IsOverlay() {
+		t.Fatal("IsOverlay() does not tell overlays apart")
+	}
+
+	overlay.Set("a", 10)
+	overlay.Set("c", 3)
+	overlay.Delete("b")
+	if v, _ := overlay.Get("a"); v != 10 {
+		t.Fatalf("overlay a = %v, want 10", v)
+	}
+	if overlay.Has("b") {
+		t.Fatal("the deleted key is visible through the overlay")
+	}
+	if got := sortedKeys(overlay.Keys()); !reflect.DeepEqual(got, []string{"__instanceId__", "a", "c"}) {
+		t.Fatalf("overlay keys = %v", got)
+	}
+	if v, _ := p.Get("a"); v != 1 || !p.Has("b") || p.Has("c") {
+		t.Fatal("the overlay modified the pipeline")
+	}
+
+	set, deleted, err := overlay.Changes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(set, map[string]any{"a": 10, "c": 3}) || !reflect.DeepEqual(deleted, []string{"b"}) {
+		t.Fatalf("Changes() = %v, %v", set, deleted)
+	}
+	// setting a deleted key again restores it
+	overlay.Set("b", 20)
+	if _, deleted, _ = overlay.Changes(); len(deleted) != 0 {
+		t.Fatalf("Changes() deleted = %v, want none", deleted)
+	}
+	if _, _, err = p.Changes(); !errors.Is(err, ErrNotOverlay) {
+		t.Fatalf("Changes() of a pipeline error = %v, want %v", err, ErrNotOverlay)
+	}
+	if clone := overlay.Clone(); clone.IsOverlay() || !reflect.DeepEqual(clone.Map(), overlay.Map()) {
+		t.Fatal("Clone() of an overlay does not hold the visible values")
+	}
+}
+
+func TestJoin(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("a", 1)
+	p.Set("b", 2)
+	p.Set("c", 3)
+	snapshot := p.Snapshot()
+	first, second := snapshot.Overlay(), snapshot.Overlay()
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		first.Set("a", "first")
+		first.Set("x", "first")
+		first.Delete("b")
+	}()
+	go func() {
+		defer wg.Done()
+		second.Set("a", "second")
+		second.Delete("c")
+	}()
+	wg.Wait()
+
+	if err := p.Join(second, first); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{InstanceIdKey: "id", "a": "first", "x": "first"}
+	if !reflect.DeepEqual(p.Map(), want) {
+		t.Fatalf("Join() = %v, want %v", p.Map(), want)
+	}
+	if v, _ := snapshot.Get("b"); v != 2 {
+		t.Fatal("Join() modified the snapshot")
+	}
+	if err := p.Join(NewPipeline("other")); !errors.Is(err, ErrNotOverlay) {
+		t.Fatalf("Join() of a pipeline error = %v, want %v", err, ErrNotOverlay)
+	}
+}
+
+func TestJoinNestedOverlays(t *testing.T) {
+	p := NewPipeline("id")
+	p.Set("a", 1)
+	outer := p.Snapshot().Overlay()
+	inner := outer.Snapshot().Overlay()
+	inner.Delete("a")
+	inner.Set("b", 2)
+	if err := outer.Join(inner); err != nil {
+		t.Fatal(err)
+	}
+	if outer.Has("a") || !outer.Has("b") {
+		t.Fatalf("outer = %v, want a deleted and b set", outer.Map())
+	}
+	if err := p.Join(outer); err != nil {
+		t.Fatal(err)
+	}
+	if p.Has("a") || !p.Has("b") {
+		t.Fatalf("pipeline = %v, want a deleted and b set", p.Map())
+	}
+}
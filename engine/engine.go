@@ -0,0 +1,355 @@
+// Package engine provides an in-process interpreter for workflows defined with the
+// orcaloop-sdk. It executes a models.Workflow step by step against the handlers
+// registered in handlers.ActionRegistry, using a data.Pipeline as the workflow state
+// and emitting an events.StepChangeEvent for every step transition. It is meant for
+// tests and local development where a remote Orcaloop server is not available.
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"sync"
+
+	"oss.nandlabs.io/golly/managers"
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/events"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/utils"
+)
+
+var ErrNilWorkflow = errors.New("workflow is required")
+var ErrNilPipeline = errors.New("pipeline is required")
+
+// EventListener is a callback that receives every step transition emitted by the Engine.
+type EventListener func(event *events.StepChangeEvent)
+
+// Engine executes workflows locally.
+// Action steps are dispatched to the handlers registered in the registry of the engine.
+type Engine struct {
+	registry  managers.ItemManager[handlers.ActionHandler]
+	listeners []EventListener
+	eventsMu  sync.Mutex
+}
+
+// NewEngine creates a new Engine that dispatches action steps to the handlers in the given registry.
+// If the registry is nil, handlers.ActionRegistry is used.
+//
+// Parameters:
+//   - registry: The registry used to look up the action handlers.
+//
+// Returns:
+//   - *Engine: A new Engine instance.
+func NewEngine(registry managers.ItemManager[handlers.ActionHandler]) *Engine {
+	if registry == nil {
+		registry = handlers.ActionRegistry
+	}
+	return &Engine{
+		registry: registry,
+	}
+}
+
+// OnEvent registers a listener that is invoked for every step transition.
+// Listeners are invoked synchronously and in the order they were registered.
+//
+// Parameters:
+//   - listener: The listener to be registered.
+//
+// Returns:
+//   - *Engine: The Engine instance to allow for method chaining.
+func (e *Engine) OnEvent(listener EventListener) *Engine {
+	e.listeners = append(e.listeners, listener)
+	return e
+}
+
+// Run executes the workflow using the pipeline as its state.
+// The workflow is validated before execution. Steps are executed in order and the
+// execution stops at the first step that fails.
+//
+// Parameters:
+//   - ctx: The context used to cancel the execution between steps.
+//   - workflow: The workflow to be executed.
+//   - pipeline: The pipeline holding the state of the workflow instance.
+//
+// Returns:
+//   - err: An error if the workflow is invalid or any of its steps failed, otherwise nil.
+func (e *Engine) Run(ctx context.Context, workflow *models.Workflow, pipeline *data.Pipeline) (err error) {
+	if workflow == nil {
+		return ErrNilWorkflow
+	}
+	if pipeline == nil {
+		return ErrNilPipeline
+	}
+	err = utils.ValidateWorkflow(*workflow)
+	if err != nil {
+		return
+	}
+	pipeline.Set(data.WorkflowIdKey, workflow.Id)
+	pipeline.Set(data.WorkflowVersionKey, strconv.Itoa(workflow.Version))
+	return e.executeSteps(ctx, workflow.Steps, pipeline)
+}
+
+// executeSteps executes the steps sequentially and stops at the first failure.
+func (e *Engine) executeSteps(ctx context.Context, steps []*models.Step, pipeline *data.Pipeline) (err error) {
+	for _, step := range steps {
+		err = e.executeStep(ctx, step, pipeline)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// executeStep executes a single step and emits the events for its transitions.
+func (e *Engine) executeStep(ctx context.Context, step *models.Step, pipeline *data.Pipeline) (err error) {
+	if err = ctx.Err(); err != nil {
+		return
+	}
+	if step.Skip {
+		e.emit(pipeline, step.Id, models.StatusSkipped, nil)
+		return
+	}
+	e.emit(pipeline, step.Id, models.StatusRunning, nil)
+	var output map[string]any
+	switch step.Type {
+	case models.StepTypeAction:
+		output, err = e.executeAction(ctx, step, pipeline)
+	case models.StepTypeIf:
+		err = e.executeIf(ctx, step, pipeline)
+	case models.StepTypeSwitch:
+		err = e.executeSwitch(ctx, step, pipeline)
+	case models.StepTypeForLoop:
+		err = e.executeFor(ctx, step, pipeline)
+	case models.StepTypeParallel:
+		err = e.executeParallel(ctx, step, pipeline)
+	default:
+		err = fmt.Errorf("invalid Step Type %s", step.Id)
+	}
+	if err != nil {
+		e.emit(pipeline, step.Id, models.StatusFailed, map[string]any{data.ErrorKey: err.Error()})
+		return
+	}
+	e.emit(pipeline, step.Id, models.StatusCompleted, output)
+	return
+}
+
+// executeAction dispatches the action step to its handler.
+// The handler receives a new pipeline holding the resolved parameters of the step.
+// Its results are copied back to the workflow pipeline as per the results of the step,
+// or by the names of the returns in the action spec if the step declares no results.
+// Handlers implementing handlers.ContextActionHandler receive the context of the run and
+// the middlewares registered with handlers.Use and handlers.UseFor are applied.
+func (e *Engine) executeAction(ctx context.Context, step *models.Step, pipeline *data.Pipeline) (output map[string]any, err error) {
+	action := step.Action
+	handler := handlers.Apply(action.Id, e.registry.Get(action.Id))
+	if handler == nil {
+		err = handlers.ErrActionNotFound(action.Id)
+		return
+	}
+	spec := handler.Spec()
+	input := data.NewPipeline(pipeline.Id())
+	input.Set(data.StepIdKey, step.Id)
+	input.Set(data.ActionIdKey, action.Id)
+	input.Set(data.WorkflowIdKey, pipeline.GetWorkflowId())
+	input.Set(data.WorkflowVersionKey, pipeline.GetWorkflowVersion())
+	for _, param := range action.Parameters {
+		value := param.Value
+		if param.Var != "" {
+			value, err = pipeline.Get(param.Var)
+			if err != nil {
+				err = fmt.Errorf("unable to resolve parameter %s of step %s: %w", param.Name, step.Id, err)
+				return
+			}
+		}
+		input.Set(param.Name, value)
+	}
+	utils.ApplyDefaults(spec, input)
+	if err = input.Coerce(spec.Parameters); err != nil {
+		return
+	}
+	if _, err = utils.ValidateInputs(spec, input); err != nil {
+		return
+	}
+	err = handlers.Invoke(ctx, handler, input)
+	if err == nil && input.Has(data.ErrorKey) {
+		err = errors.New(input.GetError())
+	}
+	if err != nil {
+		return
+	}
+
+	output = make(map[string]any)
+	if len(action.Results) > 0 {
+		for _, result := range action.Results {
+			if val, getErr := input.Get(result.OutputVar); getErr == nil {
+				output[result.PipelineVar] = val
+			}
+		}
+	} else {
+		for _, returnField := range spec.Returns {
+			if val, getErr := input.Get(returnField.Name); getErr == nil {
+				output[returnField.Name] = val
+			}
+		}
+	}
+	err = pipeline.MergeFrom(output)
+	return
+}
+
+// executeIf evaluates the conditions of the if step in order and executes the steps
+// of the first branch that matches. The else branch is executed if no condition matches.
+func (e *Engine) executeIf(ctx context.Context, step *models.Step, pipeline *data.Pipeline) (err error) {
+	var matched bool
+	matched, err = pipeline.EvaluateCondition(step.If.Condition)
+	if err != nil {
+		return
+	}
+	if matched {
+		return e.executeSteps(ctx, step.If.Steps, pipeline)
+	}
+	for _, elseIf := range step.If.ElseIfs {
+		matched, err = pipeline.EvaluateCondition(elseIf.Condition)
+		if err != nil {
+			return
+		}
+		if matched {
+			return e.executeSteps(ctx, elseIf.Steps, pipeline)
+		}
+	}
+	if step.If.Else != nil {
+		err = e.executeSteps(ctx, step.If.Else.Steps, pipeline)
+	}
+	return
+}
+
+// executeSwitch executes the steps of the first case whose value matches the switch variable.
+// The default case is executed if no case matches. A missing variable only matches the default case.
+func (e *Engine) executeSwitch(ctx context.Context, step *models.Step, pipeline *data.Pipeline) (err error) {
+	var defaultCase *models.Case
+	value, getErr := pipeline.Get(step.Switch.Variable)
+	for _, caseBlock := range step.Switch.Cases {
+		if caseBlock.Default {
+			if defaultCase == nil {
+				defaultCase = caseBlock
+			}
+			continue
+		}
+		if getErr == nil && matchCase(value, caseBlock.Value) {
+			return e.executeSteps(ctx, caseBlock.Steps, pipeline)
+		}
+	}
+	if defaultCase != nil {
+		err = e.executeSteps(ctx, defaultCase.Steps, pipeline)
+	}
+	return
+}
+
+// matchCase reports whether the switch value matches the case value.
+// Values are compared by their string representation so that numbers decoded from
+// JSON as float64 match integer case values.
+func matchCase(value, caseValue any) bool {
+	return fmt.Sprint(value) == fmt.Sprint(caseValue)
+}
+
+// executeFor executes the steps of the loop once per item.
+// The items are read from the pipeline variable ItemsVar if set, otherwise ItemsArr is used.
+// The current item and index are exposed to the loop body through Loopvar and IndexVar.
+func (e *Engine) executeFor(ctx context.Context, step *models.Step, pipeline *data.Pipeline) (err error) {
+	var items []any
+	items, err = loopItems(step.For, pipeline)
+	if err != nil {
+		return
+	}
+	for i, item := range items {
+		if step.For.Loopvar != "" {
+			pipeline.Set(step.For.Loopvar, item)
+		}
+		if step.For.IndexVar != "" {
+			pipeline.Set(step.For.IndexVar, i)
+		}
+		err = e.executeSteps(ctx, step.For.Steps, pipeline)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// loopItems resolves the items of the for loop.
+func loopItems(loop *models.For, pipeline *data.Pipeline) (items []any, err error) {
+	if loop.ItemsVar == "" {
+		items = loop.ItemsArr
+		return
+	}
+	var value any
+	value, err = pipeline.Get(loop.ItemsVar)
+	if err != nil {
+		err = fmt.Errorf("unable to resolve items %s: %w", loop.ItemsVar, err)
+		return
+	}
+	if arr, ok := value.([]any); ok {
+		items = arr
+		return
+	}
+	rv := reflect.ValueOf(value)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		err = fmt.Errorf("items %s is not an array", loop.ItemsVar)
+		return
+	}
+	items = make([]any, rv.Len())
+	for i := range items {
+		items[i] = rv.Index(i).Interface()
+	}
+	return
+}
+
+// executeParallel executes the steps concurrently. Each branch reads a snapshot of the
+// pipeline and writes to its own overlay. Once all the branches are done, the changes of
+// the branches are joined back into the pipeline in the order the steps are declared.
+func (e *Engine) executeParallel(ctx context.Context, step *models.Step, pipeline *data.Pipeline) (err error) {
+	branchCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	snapshot := pipeline.Snapshot()
+	branches := make([]*data.Pipeline, len(step.Parallel.Steps))
+	errs := make([]error, len(step.Parallel.Steps))
+	var wg sync.WaitGroup
+	for i, subStep := range step.Parallel.Steps {
+		branches[i] = snapshot.Overlay()
+		wg.Add(1)
+		go func(i int, subStep *models.Step) {
+			defer wg.Done()
+			errs[i] = e.executeStep(branchCtx, subStep, branches[i])
+			if errs[i] != nil {
+				cancel()
+			}
+		}(i, subStep)
+	}
+	wg.Wait()
+	if err = errors.Join(errs...); err != nil {
+		return
+	}
+	err = pipeline.Join(branches...)
+	return
+}
+
+// emit notifies the listeners of a step transition.
+func (e *Engine) emit(pipeline *data.Pipeline, stepId string, status models.Status, eventData map[string]any) {
+	if len(e.listeners) == 0 {
+		return
+	}
+	event := &events.StepChangeEvent{
+		EventId:    utils.GenerateId(),
+		InstanceId: pipeline.Id(),
+		StepId:     stepId,
+		Status:     status,
+		Data:       eventData,
+	}
+	e.eventsMu.Lock()
+	defer e.eventsMu.Unlock()
+	for _, listener := range e.listeners {
+		listener(event)
+	}
+}
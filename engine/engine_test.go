@@ -0,0 +1,306 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"oss.nandlabs.io/golly/managers"
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/events"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+// newRegistry creates a registry holding the handlers of the actions, keyed by the ids of their specs.
+func newRegistry(actions ...handlers.ActionHandler) managers.ItemManager[handlers.ActionHandler] {
+	registry := managers.NewItemManager[handlers.ActionHandler]()
+	for _, action := range actions {
+		registry.Register(action.Spec().Id, action)
+	}
+	return registry
+}
+
+// actionStep creates an action step passing the parameters to the action.
+func actionStep(id, actionId string, params ...*models.Parameter) *models.Step {
+	return &models.Step{Id: id, Type: models.StepTypeAction, Action: &models.StepAction{Id: actionId, Parameters: params}}
+}
+
+// recorder holds the actions used by the tests and records the labels of their invocations.
+type recorder struct {
+	mu     sync.Mutex
+	labels []string
+}
+
+func (r *recorder) log() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.labels...)
+}
+
+// registry returns the actions of the recorder:
+//   - record records its label, prefixed by its index if it has one, and returns it as out.
+//   - fail fails.
+//   - block waits until its context is cancelled.
+func (r *recorder) registry() managers.ItemManager[handlers.ActionHandler] {
+	record := handlers.NewHandler(&models.ActionSpec{
+		Id:         "record",
+		Parameters: []*models.Schema{{Name: "label", Type: models.FieldTypeString, Required: true}},
+		Returns:    []*models.Schema{{Name: "out", Type: models.FieldTypeString}},
+	}, func(ctx context.Context, p *data.Pipeline) error {
+		label, _ := p.GetString("label")
+		if index, err := p.Get("index"); err == nil {
+			label = fmt.Sprint(index, ":", label)
+		}
+		r.mu.Lock()
+		r.labels = append(r.labels, label)
+		r.mu.Unlock()
+		p.Set("out", label)
+		return nil
+	})
+	fail := handlers.NewHandler(&models.ActionSpec{Id: "fail"}, func(ctx context.Context, p *data.Pipeline) error {
+		return errors.New("failed")
+	})
+	block := handlers.NewHandler(&models.ActionSpec{Id: "block"}, func(ctx context.Context, p *data.Pipeline) error {
+		<-ctx.Done()
+		r.mu.Lock()
+		r.labels = append(r.labels, "cancelled")
+		r.mu.Unlock()
+		return ctx.Err()
+	})
+	return newRegistry(record, fail, block)
+}
+
+// record creates a step invoking the record action with the label.
+func record(id, label string) *models.Step {
+	return actionStep(id, "record", &models.Parameter{Name: "label", Value: label})
+}
+
+// run runs the steps as a workflow on a pipeline holding the values and returns the recorded labels.
+func run(t *testing.T, values map[string]any, steps ...*models.Step) ([]string, *data.Pipeline, error) {
+	t.Helper()
+	r := &recorder{}
+	pipeline := data.NewPipeline("instance")
+	for k, v := range values {
+		pipeline.Set(k, v)
+	}
+	err := NewEngine(r.registry()).Run(context.Background(), &models.Workflow{Id: "wf", Name: "wf", Steps: steps}, pipeline)
+	return r.log(), pipeline, err
+}
+
+func TestRunIf(t *testing.T) {
+	step := &models.Step{Id: "if", Type: models.StepTypeIf, If: &models.If{
+		Condition: "x == 1",
+		Steps:     []*models.Step{record("s1", "if")},
+		ElseIfs: []*models.ElseIf{
+			{Condition: "x == 2", Steps: []*models.Step{record("s2", "else-if 2")}},
+			{Condition: "x > 1", Steps: []*models.Step{record("s3", "else-if >1")}},
+		},
+		Else: &models.Else{Steps: []*models.Step{record("s4", "else")}},
+	}}
+	tests := []struct {
+		x    int
+		want []string
+	}{
+		{x: 1, want: []string{"if"}},
+		{x: 2, want: []string{"else-if 2"}},
+		{x: 3, want: []string{"else-if >1"}},
+		{x: 0, want: []string{"else"}},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.x), func(t *testing.T) {
+			got, _, err := run(t, map[string]any{"x": tt.x}, step)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Run() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunSwitch(t *testing.T) {
+	step := &models.Step{Id: "switch", Type: models.StepTypeSwitch, Switch: &models.Switch{
+		Variable: "v",
+		Cases: []*models.Case{
+			{Default: true, Steps: []*models.Step{record("d", "default")}},
+			{Value: 1, Steps: []*models.Step{record("c1", "one")}},
+			{Value: 2, Steps: []*models.Step{record("c2", "two")}},
+			{Value: "x", Steps: []*models.Step{record("cx", "x")}},
+		},
+	}}
+	tests := []struct {
+		name   string
+		values map[string]any
+		want   []string
+	}{
+		{name: "int", values: map[string]any{"v": 1}, want: []string{"one"}},
+		{name: "float64 from JSON", values: map[string]any{"v": float64(2)}, want: []string{"two"}},
+		{name: "string", values: map[string]any{"v": "x"}, want: []string{"x"}},
+		{name: "no match", values: map[string]any{"v": 3}, want: []string{"default"}},
+		{name: "missing variable", want: []string{"default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := run(t, tt.values, step)
+			if err != nil || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Run() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestRunFor(t *testing.T) {
+	body := []*models.Step{actionStep("body", "record",
+		&models.Parameter{Name: "label", Var: "item"},
+		&models.Parameter{Name: "index", Var: "i"},
+	)}
+	tests := []struct {
+		name    string
+		loop    *models.For
+		values  map[string]any
+		want    []string
+		wantErr bool
+	}{
+		{name: "items var", loop: &models.For{ItemsVar: "items", Loopvar: "item", IndexVar: "i"}, values: map[string]any{"items": []string{"a", "b"}}, want: []string{"0:a", "1:b"}},
+		{name: "items array", loop: &models.For{ItemsArr: []any{"x", "y", "z"}, Loopvar: "item", IndexVar: "i"}, want: []string{"0:x", "1:y", "2:z"}},
+		{name: "empty", loop: &models.For{ItemsVar: "items", Loopvar: "item", IndexVar: "i"}, values: map[string]any{"items": []any{}}},
+		{name: "not an array", loop: &models.For{ItemsVar: "items", Loopvar: "item"}, values: map[string]any{"items": "a"}, wantErr: true},
+		{name: "missing items", loop: &models.For{ItemsVar: "items", Loopvar: "item"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.loop.Steps = body
+			got, pipeline, err := run(t, tt.values, &models.Step{Id: "for", Type: models.StepTypeForLoop, For: tt.loop})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Run() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Run() = %v, want %v", got, tt.want)
+			}
+			// the loop variables hold the last item once the loop is done
+			if i, err := pipeline.Get("i"); len(tt.want) > 0 && (err != nil || i != len(tt.want)-1) {
+				t.Fatalf("i = %v, %v, want %d", i, err, len(tt.want)-1)
+			}
+		})
+	}
+}
+
+func TestRunParallel(t *testing.T) {
+	branch := func(id, label, pipelineVar string) *models.Step {
+		step := record(id, label)
+		step.Action.Results = []*models.Result{{OutputVar: "out", PipelineVar: pipelineVar}}
+		return step
+	}
+	got, pipeline, err := run(t, map[string]any{"a": "before"}, &models.Step{Id: "parallel", Type: models.StepTypeParallel, Parallel: &models.Parallel{
+		Steps: []*models.Step{branch("b1", "first", "a"), branch("b2", "second", "b")},
+	}})
+	if err != nil || len(got) != 2 {
+		t.Fatalf("Run() = %v, %v", got, err)
+	}
+	a, _ := pipeline.GetString("a")
+	b, _ := pipeline.GetString("b")
+	if a != "first" || b != "second" {
+		t.Fatalf("pipeline = %v, want the outputs of both branches", pipeline.Map())
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		got, _, err = run(t, nil, &models.Step{Id: "parallel", Type: models.StepTypeParallel, Parallel: &models.Parallel{
+			Steps: []*models.Step{actionStep("blocked", "block"), actionStep("failed", "fail")},
+		}})
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the failure of a branch did not cancel the other branches")
+	}
+	// the blocked branch is cancelled, or not started if the failure came first
+	if err == nil || len(got) > 1 || len(got) == 1 && got[0] != "cancelled" {
+		t.Fatalf("Run() = %v, %v, want the blocked branch cancelled and an error", got, err)
+	}
+}
+
+func TestRunEvents(t *testing.T) {
+	r := &recorder{}
+	var mu sync.Mutex
+	var got []string
+	e := NewEngine(r.registry()).OnEvent(func(event *events.StepChangeEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, event.StepId+" "+event.Status.String())
+	})
+	skipped := record("s2", "skipped")
+	skipped.Skip = true
+	workflow := &models.Workflow{Id: "wf", Name: "wf", Steps: []*models.Step{
+		record("s1", "first"),
+		skipped,
+		actionStep("s3", "fail"),
+		record("s4", "never"),
+	}}
+	err := e.Run(context.Background(), workflow, data.NewPipeline("instance"))
+	if err == nil {
+		t.Fatal("Run() succeeded, want the error of s3")
+	}
+	want := []string{"s1 Running", "s1 Completed", "s2 Skipped", "s3 Running", "s3 Failed"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("events = %v, want %v", got, want)
+	}
+	if labels := r.log(); !reflect.DeepEqual(labels, []string{"first"}) {
+		t.Fatalf("invoked actions = %v, want only s1", labels)
+	}
+}
+
+func TestRunErrors(t *testing.T) {
+	e := NewEngine(newRegistry())
+	if err := e.Run(context.Background(), nil, data.NewPipeline("i")); !errors.Is(err, ErrNilWorkflow) {
+		t.Fatalf("Run(nil workflow) error = %v", err)
+	}
+	workflow := &models.Workflow{Id: "wf", Name: "wf", Steps: []*models.Step{actionStep("s1", "missing")}}
+	if err := e.Run(context.Background(), workflow, nil); !errors.Is(err, ErrNilPipeline) {
+		t.Fatalf("Run(nil pipeline) error = %v", err)
+	}
+	if err := e.Run(context.Background(), workflow, data.NewPipeline("i")); err == nil {
+		t.Fatal("Run() of an unknown action succeeded")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := e.Run(ctx, workflow, data.NewPipeline("i")); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Run() with a cancelled context error = %v", err)
+	}
+}
+
+func TestRunCoercesBeforeValidating(t *testing.T) {
+	var got any
+	double := handlers.NewHandler(&models.ActionSpec{
+		Id: "double",
+		Parameters: []*models.Schema{
+			{Name: "n", Type: models.FieldTypeInt, Required: true},
+			{Name: "mode", Type: models.FieldTypeString, Enum: []any{"fast", "slow"}, Default: "fast"},
+		},
+	}, func(ctx context.Context, p *data.Pipeline) error {
+		got, _ = p.Get("n")
+		return nil
+	})
+	e := NewEngine(newRegistry(double))
+	workflow := &models.Workflow{Id: "wf", Name: "wf", Steps: []*models.Step{
+		actionStep("s1", "double", &models.Parameter{Name: "n", Value: "5"}),
+	}}
+	if err := e.Run(context.Background(), workflow, data.NewPipeline("i")); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if got != 5 {
+		t.Fatalf("n = %#v, want the coerced 5", got)
+	}
+
+	workflow.Steps[0].Action.Parameters = append(workflow.Steps[0].Action.Parameters, &models.Parameter{Name: "mode", Value: "medium"})
+	if err := e.Run(context.Background(), workflow, data.NewPipeline("i")); err == nil {
+		t.Fatal("Run() accepted a value outside the enum")
+	}
+}
@@ -0,0 +1,31 @@
+package events
+
+import "time"
+
+const (
+	// ProgressTypeHeartbeat marks a ProgressEvent sent periodically to signal that the handler is alive.
+	ProgressTypeHeartbeat = "heartbeat"
+	// ProgressTypeProgress marks a ProgressEvent reported by the handler.
+	ProgressTypeProgress = "progress"
+)
+
+// ProgressEvent represents the progress of a running step, reported while its action handler runs.
+// It contains the following fields:
+// - EventId: The unique identifier of the event.
+// - InstanceId: The unique identifier of the pipeline instance.
+// - StepId: The unique identifier of the step within the pipeline instance.
+// - Type: The type of the event, ProgressTypeHeartbeat or ProgressTypeProgress.
+// - Percent: The percentage of the work completed, between 0 and 100, or -1 if unknown.
+// - Message: A message describing the current state of the work.
+// - Data: The partial output of the step.
+// - Timestamp: The time the event was created.
+type ProgressEvent struct {
+	EventId    string         `json:"event_id" yaml:"event_id"`
+	InstanceId string         `json:"instance_id" yaml:"instance_id"`
+	StepId     string         `json:"step_id" yaml:"step_id"`
+	Type       string         `json:"type" yaml:"type"`
+	Percent    float64        `json:"percent" yaml:"percent"`
+	Message    string         `json:"message,omitempty" yaml:"message,omitempty"`
+	Data       map[string]any `json:"data,omitempty" yaml:"data,omitempty"`
+	Timestamp  time.Time      `json:"timestamp" yaml:"timestamp"`
+}
@@ -8,10 +8,12 @@ import "oss.nandlabs.io/orcaloop-sdk/models"
 // - StepId: The unique identifier of the step within the pipeline instance.
 // - Status: The current status of the step.
 // - Data: Additional data related to the pipeline, represented by a Pipeline object.
+// - Error: The error of a failed step, if any.
 type StepChangeEvent struct {
 	EventId    string         `json:"event_id" yaml:"event_id"`
 	InstanceId string         `json:"instance_id" yaml:"instance_id"`
 	StepId     string         `json:"step_id" yaml:"step_id"`
 	Status     models.Status  `json:"status" yaml:"status"`
 	Data       map[string]any `json:"data" yaml:"data"`
+	Error      *models.Error  `json:"error,omitempty" yaml:"error,omitempty"`
 }
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"context"
 	"errors"
 
 	"oss.nandlabs.io/golly/managers"
@@ -16,3 +17,93 @@ type ActionHandler interface {
 	Handle(pipeline *data.Pipeline) error
 	Spec() *models.ActionSpec
 }
+
+// ContextActionHandler is an ActionHandler that receives a context.Context carrying the
+// deadline, the cancellation and the metadata of the invocation.
+// Handlers implementing it are invoked with HandleContext by the action service,
+// Handle remains available for callers without a context.
+type ContextActionHandler interface {
+	ActionHandler
+	HandleContext(ctx context.Context, pipeline *data.Pipeline) error
+}
+
+// HandlerFunc is a function implementing an action with a context.
+type HandlerFunc func(ctx context.Context, pipeline *data.Pipeline) error
+
+// funcHandler is a ContextActionHandler backed by a HandlerFunc.
+type funcHandler struct {
+	spec *models.ActionSpec
+	fn   HandlerFunc
+}
+
+// NewHandler creates a ContextActionHandler for the spec that invokes the function.
+// Handle invokes the function with context.Background().
+//
+// Parameters:
+//   - spec: The spec of the action.
+//   - fn: The function implementing the action.
+//
+// Returns:
+//   - ContextActionHandler: The handler, ready to be registered in the ActionRegistry.
+func NewHandler(spec *models.ActionSpec, fn HandlerFunc) ContextActionHandler {
+	return &funcHandler{
+		spec: spec,
+		fn:   fn,
+	}
+}
+
+// Spec returns the spec of the action.
+func (h *funcHandler) Spec() *models.ActionSpec {
+	return h.spec
+}
+
+// Handle invokes the function with context.Background().
+func (h *funcHandler) Handle(pipeline *data.Pipeline) error {
+	return h.fn(context.Background(), pipeline)
+}
+
+// HandleContext invokes the function with the context.
+func (h *funcHandler) HandleContext(ctx context.Context, pipeline *data.Pipeline) error {
+	return h.fn(ctx, pipeline)
+}
+
+// Invoke invokes the handler with the context. Handlers implementing ContextActionHandler
+// receive the context, other handlers are invoked using Handle and cannot be interrupted
+// once they started. The context error is returned without invoking the handler if the
+// context is already done.
+//
+// Parameters:
+//   - ctx: The context of the invocation.
+//   - handler: The handler to be invoked.
+//   - pipeline: The pipeline passed to the handler.
+//
+// Returns:
+//
+//	The error returned by the handler or the context.
+func Invoke(ctx context.Context, handler ActionHandler, pipeline *data.Pipeline) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if h, ok := handler.(ContextActionHandler); ok {
+		return h.HandleContext(ctx, pipeline)
+	}
+	return handler.Handle(pipeline)
+}
+
+// metadataKey is the context key of the Metadata.
+type metadataKey struct{}
+
+// Metadata holds the metadata of an invocation such as trace and authorization headers.
+// Keys are in canonical MIME header format, e.g. Authorization or Traceparent.
+type Metadata map[string]string
+
+// WithMetadata returns a copy of the context carrying the metadata.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	return context.WithValue(ctx, metadataKey{}, md)
+}
+
+// MetadataFromContext returns the metadata carried by the context, or nil if there is none.
+func MetadataFromContext(ctx context.Context) Metadata {
+	md, _ := ctx.Value(metadataKey{}).(Metadata)
+	return md
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"context"
+	"sync"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+)
+
+// Middleware decorates an ActionHandler with behaviour shared across actions such as logging,
+// recovery or metrics. The returned handler must return the Spec of the next handler,
+// NewHandler can be used to build it:
+//
+//	func(next ActionHandler) ActionHandler {
+//		return NewHandler(next.Spec(), func(ctx context.Context, pipeline *data.Pipeline) error {
+//			// before
+//			err := Invoke(ctx, next, pipeline)
+//			// after
+//			return err
+//		})
+//	}
+type Middleware func(next ActionHandler) ActionHandler
+
+var (
+	middlewareMu      sync.RWMutex
+	globalMiddlewares []Middleware
+	actionMiddlewares = make(map[string][]Middleware)
+)
+
+// Use registers middlewares applied to every action.
+// Middlewares are applied in the order they are registered, the first one being the outermost.
+//
+// Parameters:
+//   - middlewares: The middlewares to be registered.
+func Use(middlewares ...Middleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	globalMiddlewares = append(globalMiddlewares, middlewares...)
+}
+
+// UseFor registers middlewares applied to the action with the id only.
+// They are applied inside the middlewares registered with Use, in the order they are registered.
+//
+// Parameters:
+//   - actionId: The id of the action.
+//   - middlewares: The middlewares to be registered.
+func UseFor(actionId string, middlewares ...Middleware) {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	actionMiddlewares[actionId] = append(actionMiddlewares[actionId], middlewares...)
+}
+
+// ResetMiddlewares removes all the registered middlewares.
+func ResetMiddlewares() {
+	middlewareMu.Lock()
+	defer middlewareMu.Unlock()
+	globalMiddlewares = nil
+	actionMiddlewares = make(map[string][]Middleware)
+}
+
+// Chain decorates the handler with the middlewares, the first middleware being the outermost.
+//
+// Parameters:
+//   - handler: The handler to be decorated.
+//   - middlewares: The middlewares to apply.
+//
+// Returns:
+//   - ActionHandler: The decorated handler.
+func Chain(handler ActionHandler, middlewares ...Middleware) ActionHandler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		handler = middlewares[i](handler)
+	}
+	return handler
+}
+
+// Apply decorates the handler of the action with the middlewares registered using Use and UseFor.
+// It is used by the action service before every invocation of a handler. A nil handler is returned as is.
+//
+// Parameters:
+//   - actionId: The id of the action.
+//   - handler: The handler of the action.
+//
+// Returns:
+//   - ActionHandler: The decorated handler.
+func Apply(actionId string, handler ActionHandler) ActionHandler {
+	if handler == nil {
+		return nil
+	}
+	middlewareMu.RLock()
+	middlewares := make([]Middleware, 0, len(globalMiddlewares)+len(actionMiddlewares[actionId]))
+	middlewares = append(middlewares, globalMiddlewares...)
+	middlewares = append(middlewares, actionMiddlewares[actionId]...)
+	middlewareMu.RUnlock()
+	return Chain(handler, middlewares...)
+}
+
+// Resolve looks up the handler of the action in the ActionRegistry and decorates it using Apply.
+//
+// Parameters:
+//   - actionId: The id of the action.
+//
+// Returns:
+//   - ActionHandler: The decorated handler, nil if the action is not registered.
+func Resolve(actionId string) ActionHandler {
+	return Apply(actionId, ActionRegistry.Get(actionId))
+}
+
+// wrap creates a middleware from a function receiving the next handler with the invocation.
+func wrap(fn func(ctx context.Context, pipeline *data.Pipeline, next ActionHandler) error) Middleware {
+	return func(next ActionHandler) ActionHandler {
+		return NewHandler(next.Spec(), func(ctx context.Context, pipeline *data.Pipeline) error {
+			return fn(ctx, pipeline, next)
+		})
+	}
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"oss.nandlabs.io/golly/l3"
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/utils"
+)
+
+var logger = l3.Get()
+
+// PanicError is the error returned by the Recover middleware when a handler panics.
+type PanicError struct {
+	// ActionId is the id of the action whose handler panicked
+	ActionId string
+	// Value is the value passed to panic
+	Value any
+	// Stack is the stack trace of the goroutine at the time of the panic
+	Stack []byte
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("action %s panicked: %v", e.ActionId, e.Value)
+}
+
+// Recover returns a middleware converting a panic of the handler into a *PanicError.
+func Recover() Middleware {
+	return wrap(func(ctx context.Context, pipeline *data.Pipeline, next ActionHandler) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				err = &PanicError{
+					ActionId: next.Spec().Id,
+					Value:    r,
+					Stack:    debug.Stack(),
+				}
+			}
+		}()
+		return Invoke(ctx, next, pipeline)
+	})
+}
+
+// Logging returns a middleware logging every invocation with the action, instance and step ids,
+// its duration and its outcome. Failed invocations are logged as errors. A nil logger uses l3.Get().
+func Logging(log l3.Logger) Middleware {
+	if log == nil {
+		log = logger
+	}
+	return wrap(func(ctx context.Context, pipeline *data.Pipeline, next ActionHandler) error {
+		start := time.Now()
+		err := Invoke(ctx, next, pipeline)
+		fields := fmt.Sprintf("action=%s instance=%s step=%s duration=%s",
+			next.Spec().Id, pipeline.Id(), pipeline.GetStepId(), time.Since(start))
+		if err != nil {
+			log.ErrorF("action failed %s error=%q", fields, err.Error())
+		} else {
+			log.InfoF("action completed %s", fields)
+		}
+		return err
+	})
+}
+
+// ValidateInputs returns a middleware rejecting invocations whose pipeline does not satisfy
+// the parameters of the action spec, see utils.ValidateInputs. The handler is not invoked
+// if the inputs are invalid.
+func ValidateInputs() Middleware {
+	return wrap(func(ctx context.Context, pipeline *data.Pipeline, next ActionHandler) error {
+		if _, err := utils.ValidateInputs(next.Spec(), pipeline); err != nil {
+			return fmt.Errorf("invalid inputs: %w", err)
+		}
+		return Invoke(ctx, next, pipeline)
+	})
+}
+
+// Timing returns a middleware reporting the duration and the error of every invocation to the observer,
+// e.g. to record them as metrics.
+func Timing(observe func(actionId string, duration time.Duration, err error)) Middleware {
+	return wrap(func(ctx context.Context, pipeline *data.Pipeline, next ActionHandler) error {
+		start := time.Now()
+		err := Invoke(ctx, next, pipeline)
+		observe(next.Spec().Id, time.Since(start), err)
+		return err
+	})
+}
@@ -0,0 +1,44 @@
+package handlers
+
+import "context"
+
+// ProgressReporter reports the progress of a running action handler to the Orcaloop server.
+type ProgressReporter interface {
+	// Progress reports the percentage of the work completed, a message and the partial output of the handler.
+	Progress(percent float64, message string, partial map[string]any) error
+}
+
+// progressKey is the context key of the ProgressReporter.
+type progressKey struct{}
+
+// WithProgressReporter returns a copy of the context carrying the reporter.
+func WithProgressReporter(ctx context.Context, reporter ProgressReporter) context.Context {
+	return context.WithValue(ctx, progressKey{}, reporter)
+}
+
+// ProgressReporterFromContext returns the reporter carried by the context, or nil if there is none.
+func ProgressReporterFromContext(ctx context.Context) ProgressReporter {
+	reporter, _ := ctx.Value(progressKey{}).(ProgressReporter)
+	return reporter
+}
+
+// ReportProgress reports the progress of the handler invoked with the context.
+// The action service provides a reporter to the handlers of asynchronous actions, for other
+// invocations ReportProgress does nothing and returns nil.
+//
+// Parameters:
+//   - ctx: The context the handler was invoked with.
+//   - percent: The percentage of the work completed, between 0 and 100, or -1 if unknown.
+//   - message: A message describing the current state of the work.
+//   - partial: The partial output of the handler, may be nil.
+//
+// Returns:
+//
+//	An error if the progress could not be reported.
+func ReportProgress(ctx context.Context, percent float64, message string, partial map[string]any) error {
+	reporter := ProgressReporterFromContext(ctx)
+	if reporter == nil {
+		return nil
+	}
+	return reporter.Progress(percent, message, partial)
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+const (
+	// TagRequired is the struct tag marking a field as required, e.g. `required:"true"`.
+	TagRequired = "required"
+	// TagDescription is the struct tag holding the description of a field.
+	TagDescription = "description"
+	// TagEnum is the struct tag holding the comma separated allowed values of a field, e.g. `enum:"NEW,OPEN"`.
+	TagEnum = "enum"
+	// TagDefault is the struct tag holding the default value of a field, e.g. `default:"10"`.
+	TagDefault = "default"
+)
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// SchemasOf derives the schemas of the fields of a struct type.
+// Every exported field becomes a schema named by its json tag, fields tagged with json:"-"
+// are skipped and the fields of embedded structs are promoted as done by encoding/json.
+// The type of the schema is derived from the Go type of the field, nested structs become
+// objects with Properties and slices become arrays with Items. The required, description,
+// enum and default struct tags populate the corresponding attributes of the schema.
+//
+// Parameters:
+//   - t: The struct type, or a pointer to it.
+//
+// Returns:
+//   - schemas: The schemas of the fields.
+//   - err: An error if t is not a struct or a tag value cannot be converted to the type of its field.
+func SchemasOf(t reflect.Type) (schemas []*models.Schema, err error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		err = fmt.Errorf("expected a struct type, got %s", t)
+		return
+	}
+	return structSchemas(t, map[reflect.Type]bool{})
+}
+
+// structSchemas derives the schemas of the fields of the struct. visiting guards against recursive types.
+func structSchemas(t reflect.Type, visiting map[reflect.Type]bool) (schemas []*models.Schema, err error) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := fieldName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				var embedded []*models.Schema
+				embedded, err = structSchemas(ft, visiting)
+				if err != nil {
+					return
+				}
+				schemas = append(schemas, embedded...)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		var schema *models.Schema
+		schema, err = typeSchema(field.Type, visiting)
+		if err != nil {
+			return
+		}
+		schema.Name = name
+		schema.Description = field.Tag.Get(TagDescription)
+		schema.Required = field.Tag.Get(TagRequired) == "true"
+		err = applyTags(schema, field)
+		if err != nil {
+			return
+		}
+		schemas = append(schemas, schema)
+	}
+	return
+}
+
+// fieldName returns the name of the field from its json tag. skip is set for unexported fields and fields tagged with json:"-".
+func fieldName(field reflect.StructField) (name string, skip bool) {
+	if !field.IsExported() && !field.Anonymous {
+		return "", true
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", true
+	}
+	name, _, _ = strings.Cut(tag, ",")
+	return
+}
+
+// typeSchema derives the schema of a Go type.
+func typeSchema(t reflect.Type, visiting map[reflect.Type]bool) (schema *models.Schema, err error) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	schema = &models.Schema{}
+	if t == timeType {
+		schema.Type = models.FieldTypeDateStr
+		return
+	}
+	switch t.Kind() {
+	case reflect.String:
+		schema.Type = models.FieldTypeString
+	case reflect.Bool:
+		schema.Type = models.FieldTypeBool
+	case reflect.Uint8:
+		schema.Type = models.FieldTypeByte
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint16, reflect.Uint32:
+		schema.Type = models.FieldTypeInt
+	case reflect.Int64, reflect.Uint, reflect.Uint64:
+		schema.Type = models.FieldTypeInt64
+	case reflect.Float32:
+		schema.Type = models.FieldTypeFloat32
+	case reflect.Float64:
+		schema.Type = models.FieldTypeFloat64
+	case reflect.Map:
+		schema.Type = models.FieldTypeObject
+	case reflect.Struct:
+		schema.Type = models.FieldTypeObject
+		schema.Properties, err = structSchemas(t, visiting)
+	case reflect.Slice, reflect.Array:
+		if t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8 {
+			// encoding/json encodes byte slices as base64 strings
+			schema.Type = models.FieldTypeString
+			return
+		}
+		schema.Type = models.FieldTypeArray
+		schema.Items, err = typeSchema(t.Elem(), visiting)
+	}
+	return
+}
+
+// applyTags sets the enum and default values of the schema from the struct tags of the field.
+// The tag values are converted to the type of the schema, defaults of objects and arrays are decoded as JSON.
+func applyTags(schema *models.Schema, field reflect.StructField) (err error) {
+	if tag, ok := field.Tag.Lookup(TagDefault); ok {
+		if schema.Type == models.FieldTypeObject || schema.Type == models.FieldTypeArray {
+			err = json.Unmarshal([]byte(tag), &schema.Default)
+		} else {
+			schema.Default, err = data.CoerceTo(tag, schema)
+		}
+		if err != nil {
+			return fmt.Errorf("invalid default value of field %s: %w", field.Name, err)
+		}
+	}
+	if tag, ok := field.Tag.Lookup(TagEnum); ok && tag != "" {
+		values := strings.Split(tag, ",")
+		enum := make([]any, len(values))
+		for i, v := range values {
+			enum[i], err = data.CoerceTo(strings.TrimSpace(v), schema)
+			if err != nil {
+				return fmt.Errorf("invalid enum value of field %s: %w", field.Name, err)
+			}
+		}
+		schema.Enum = enum
+	}
+	return
+}
@@ -0,0 +1,165 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+// TypedHandler is an ActionHandler that invokes a function with a typed input and output.
+// The pipeline is decoded into the input struct before the function is invoked and the fields
+// of the output struct are written back to the pipeline once it returns.
+// The ActionSpec of the handler is derived from the input and output structs, see SchemasOf.
+type TypedHandler[In, Out any] struct {
+	spec *models.ActionSpec
+	fn   func(ctx context.Context, in In) (Out, error)
+}
+
+// NewTypedHandler creates a new TypedHandler for the function.
+// The Parameters of the spec are derived from the fields of In and the Returns from the fields of Out.
+// Other attributes of the spec, such as the Description or the Endpoint, can be set on the spec
+// returned by Spec. It panics if In or Out is not a struct or their struct tags are invalid.
+//
+// Parameters:
+//   - id: The id of the action.
+//   - name: The name of the action.
+//   - fn: The function implementing the action.
+//
+// Returns:
+//   - *TypedHandler[In, Out]: The handler, ready to be registered in the ActionRegistry.
+func NewTypedHandler[In, Out any](id, name string, fn func(ctx context.Context, in In) (Out, error)) *TypedHandler[In, Out] {
+	parameters, err := SchemasOf(reflect.TypeOf((*In)(nil)).Elem())
+	if err != nil {
+		panic(fmt.Sprintf("invalid input type of action %s: %v", id, err))
+	}
+	returns, err := SchemasOf(reflect.TypeOf((*Out)(nil)).Elem())
+	if err != nil {
+		panic(fmt.Sprintf("invalid output type of action %s: %v", id, err))
+	}
+	return &TypedHandler[In, Out]{
+		spec: &models.ActionSpec{
+			Id:         id,
+			Name:       name,
+			Parameters: parameters,
+			Returns:    returns,
+		},
+		fn: fn,
+	}
+}
+
+// Spec returns the ActionSpec derived for the handler.
+func (h *TypedHandler[In, Out]) Spec() *models.ActionSpec {
+	return h.spec
+}
+
+// Handle invokes HandleContext with context.Background().
+func (h *TypedHandler[In, Out]) Handle(pipeline *data.Pipeline) error {
+	return h.HandleContext(context.Background(), pipeline)
+}
+
+// HandleContext decodes the pipeline into the input, invokes the function with the context and writes the output to the pipeline.
+func (h *TypedHandler[In, Out]) HandleContext(ctx context.Context, pipeline *data.Pipeline) (err error) {
+	var in In
+	err = Decode(pipeline, &in)
+	if err != nil {
+		return fmt.Errorf("unable to decode the input of action %s: %w", h.spec.Id, err)
+	}
+	var out Out
+	out, err = h.fn(ctx, in)
+	if err != nil {
+		return
+	}
+	err = Encode(out, pipeline)
+	if err != nil {
+		err = fmt.Errorf("unable to encode the output of action %s: %w", h.spec.Id, err)
+	}
+	return
+}
+
+// Decode decodes the values of the pipeline into the struct pointed to by v.
+// Only the values of the fields of the struct are decoded, they are matched to the fields
+// the same way encoding/json does. Numbers decoded into fields of type any are json.Number.
+func Decode(pipeline *data.Pipeline, v any) (err error) {
+	t := reflect.TypeOf(v)
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return fmt.Errorf("expected a pointer to a struct, got %T", v)
+	}
+	names := fieldNames(t, map[reflect.Type]bool{})
+	values := make(map[string]any, len(names))
+	for key, value := range pipeline.Map() {
+		for _, name := range names {
+			if strings.EqualFold(key, name) {
+				values[key] = value
+				break
+			}
+		}
+	}
+	var b []byte
+	b, err = json.Marshal(values)
+	if err != nil {
+		return
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	return decoder.Decode(v)
+}
+
+// Encode writes the fields of the struct v to the pipeline, each named by its json tag.
+// Values are converted to their JSON representation, i.e. nested structs become maps,
+// slices become []any and numbers become json.Number, keeping the precision of 64-bit integers.
+func Encode(v any, pipeline *data.Pipeline) (err error) {
+	var b []byte
+	b, err = json.Marshal(v)
+	if err != nil {
+		return
+	}
+	values := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber()
+	err = decoder.Decode(&values)
+	if err != nil {
+		return
+	}
+	return pipeline.MergeFrom(values)
+}
+
+// fieldNames returns the json names of the fields of the struct, including the fields of embedded structs.
+// visiting guards against recursive types.
+func fieldNames(t reflect.Type, visiting map[reflect.Type]bool) (names []string) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, skip := fieldName(field)
+		if skip {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			ft := field.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				names = append(names, fieldNames(ft, visiting)...)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		names = append(names, name)
+	}
+	return
+}
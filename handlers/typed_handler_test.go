@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+)
+
+type audit struct {
+	User string `json:"user"`
+}
+
+type transferInput struct {
+	audit
+	AccountId int64 `json:"account_id"`
+	Amount    float64
+	Memo      any    `json:"memo"`
+	Ignored   string `json:"-"`
+}
+
+type transferOutput struct {
+	TransferId int64          `json:"transfer_id"`
+	Fees       []float64      `json:"fees"`
+	Meta       map[string]any `json:"meta"`
+}
+
+const bigId = int64(1<<53 + 1)
+
+func TestDecode(t *testing.T) {
+	p := data.NewPipeline("id")
+	p.Set("account_id", bigId)
+	p.Set("amount", 12.5)
+	p.Set("user", "alice")
+	p.Set("memo", json.Number("9007199254740993"))
+	p.Set("Ignored", "x")
+	// values that are not fields of the input are not decoded
+	p.Set("callback", func() {})
+
+	var in transferInput
+	if err := Decode(p, &in); err != nil {
+		t.Fatalf("Decode() error = %v", err)
+	}
+	if in.AccountId != bigId || in.Amount != 12.5 || in.User != "alice" || in.Ignored != "" {
+		t.Fatalf("Decode() = %+v", in)
+	}
+	if in.Memo != json.Number("9007199254740993") {
+		t.Fatalf("Decode() memo = %#v, want the json.Number", in.Memo)
+	}
+	if err := Decode(p, in); err == nil {
+		t.Fatal("Decode() accepted a struct value")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	p := data.NewPipeline("id")
+	out := transferOutput{TransferId: bigId, Fees: []float64{0.5}, Meta: map[string]any{"n": int64(1)}}
+	if err := Encode(out, p); err != nil {
+		t.Fatalf("Encode() error = %v", err)
+	}
+	id, err := transferId(p)
+	if err != nil || id != bigId {
+		t.Fatalf("transfer_id = %v, %v, want %d", id, err, bigId)
+	}
+	fees, _ := p.Get("fees")
+	if fees.([]any)[0] != json.Number("0.5") {
+		t.Fatalf("fees = %#v", fees)
+	}
+}
+
+func TestTypedHandler(t *testing.T) {
+	h := NewTypedHandler("transfer", "Transfer", func(ctx context.Context, in transferInput) (transferOutput, error) {
+		return transferOutput{TransferId: in.AccountId}, nil
+	})
+	p := data.NewPipeline("id")
+	p.Set("account_id", bigId)
+	if err := h.HandleContext(context.Background(), p); err != nil {
+		t.Fatal(err)
+	}
+	if id, err := transferId(p); err != nil || id != bigId {
+		t.Fatalf("transfer_id = %v, %v, want %d", id, err, bigId)
+	}
+}
+
+func transferId(p *data.Pipeline) (int64, error) {
+	v, err := p.Get("transfer_id")
+	if err != nil {
+		return 0, err
+	}
+	return data.ToInt64(v)
+}
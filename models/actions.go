@@ -66,7 +66,7 @@ type Endpoint struct {
 type Qos struct {
 	// Retries is the number of retries
 	Retries int
-	// Timeout is the timeout
+	// Timeout is the timeout in milliseconds, zero means no timeout
 	Timeout int
 	// CircuitBreakerInfo is the circuit breaker info
 	BreakerInfo *clients.BreakerInfo
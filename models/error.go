@@ -10,3 +10,12 @@ type Error struct {
 	// This is an optional field
 	Details string `json:"details,omitempty" yaml:"details,omitempty"`
 }
+
+const (
+	// ErrCodeActionFailed is the code of the error reported when an action handler fails
+	ErrCodeActionFailed = "ACTION_FAILED"
+	// ErrCodeActionPanic is the code of the error reported when an action handler panics
+	ErrCodeActionPanic = "ACTION_PANIC"
+	// ErrCodeActionQuarantined is the code of the error reported when an action is invoked while it is quarantined
+	ErrCodeActionQuarantined = "ACTION_QUARANTINED"
+)
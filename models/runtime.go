@@ -13,6 +13,10 @@ const (
 	StatusFailed
 	// StatusSkipped represents a skipped status of the workflow
 	StatusSkipped
+	// StatusCancelled represents a cancelled status of the workflow
+	StatusCancelled
+	// StatusWaiting represents a workflow waiting for an external signal
+	StatusWaiting
 
 	// String representations of the status constants
 
@@ -26,6 +30,10 @@ const (
 	StatusFailedStr = "Failed"
 	// StatusSkippedStr is the string representation of the StatusSkipped constant
 	StatusSkippedStr = "Skipped"
+	// StatusCancelledStr is the string representation of the StatusCancelled constant
+	StatusCancelledStr = "Cancelled"
+	// StatusWaitingStr is the string representation of the StatusWaiting constant
+	StatusWaitingStr = "Waiting"
 	// StatusUnkonwnStr is the string representation of the StatusUnknown constant
 	StatusUnkonwnStr = "Unknown"
 )
@@ -49,7 +57,73 @@ func (s Status) String() string {
 		return StatusFailedStr
 	case StatusSkipped:
 		return StatusSkippedStr
+	case StatusCancelled:
+		return StatusCancelledStr
+	case StatusWaiting:
+		return StatusWaitingStr
 	default:
 		return StatusUnkonwnStr
 	}
 }
+
+// IsTerminal checks if the Status is final, i.e. completed, failed, skipped or cancelled.
+func (s Status) IsTerminal() bool {
+	switch s {
+	case StatusCompleted, StatusFailed, StatusSkipped, StatusCancelled:
+		return true
+	default:
+		return false
+	}
+}
+
+// WorkflowInstance represents the state of a running or finished workflow instance.
+// Fields:
+// - Id: Unique identifier of the instance.
+// - WorkflowId: Identifier of the workflow of the instance.
+// - WorkflowVersion: Version of the workflow of the instance.
+// - Status: Status of the instance.
+// - Steps: Status of every step of the workflow that started, by step id.
+// - Data: Pipeline data of the instance.
+// - Error: Error of a failed instance.
+type WorkflowInstance struct {
+	Id              string            `yaml:"id" json:"id"`
+	WorkflowId      string            `yaml:"workflow_id" json:"workflow_id"`
+	WorkflowVersion int               `yaml:"workflow_version" json:"workflow_version"`
+	Status          Status            `yaml:"status" json:"status"`
+	Steps           map[string]Status `yaml:"steps,omitempty" json:"steps,omitempty"`
+	Data            map[string]any    `yaml:"data,omitempty" json:"data,omitempty"`
+	Error           *Error            `yaml:"error,omitempty" json:"error,omitempty"`
+}
+
+// InstanceList represents a page of workflow instances.
+// Fields:
+// - Items: Instances of the page.
+// - Page: Number of the page, starting at 1.
+// - PageSize: Maximum number of instances per page.
+// - Total: Total number of instances matching the query.
+type InstanceList struct {
+	Items    []*WorkflowInstance `yaml:"items" json:"items"`
+	Page     int                 `yaml:"page" json:"page"`
+	PageSize int                 `yaml:"page_size" json:"page_size"`
+	Total    int                 `yaml:"total" json:"total"`
+}
+
+// StartInstanceRequest represents a request to start a workflow instance.
+// Fields:
+// - WorkflowId: Identifier of the workflow to start.
+// - WorkflowVersion: Version of the workflow to start, zero starts the latest version.
+// - Data: Initial pipeline data of the instance.
+type StartInstanceRequest struct {
+	WorkflowId      string         `yaml:"workflow_id" json:"workflow_id"`
+	WorkflowVersion int            `yaml:"workflow_version,omitempty" json:"workflow_version,omitempty"`
+	Data            map[string]any `yaml:"data,omitempty" json:"data,omitempty"`
+}
+
+// Signal represents an external signal sent to a workflow instance.
+// Fields:
+// - Name: Name of the signal the instance waits for.
+// - Data: Data merged into the pipeline of the instance.
+type Signal struct {
+	Name string         `yaml:"name" json:"name"`
+	Data map[string]any `yaml:"data,omitempty" json:"data,omitempty"`
+}
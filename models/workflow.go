@@ -160,3 +160,16 @@ type Case struct {
 	Default bool    `yaml:"default" json:"default"`
 	Steps   []*Step `yaml:"steps" json:"steps"`
 }
+
+// WorkflowList represents a page of workflow definitions.
+// Fields:
+// - Items: Workflows of the page.
+// - Page: Number of the page, starting at 1.
+// - PageSize: Maximum number of workflows per page.
+// - Total: Total number of workflows matching the query.
+type WorkflowList struct {
+	Items    []*Workflow `yaml:"items" json:"items"`
+	Page     int         `yaml:"page" json:"page"`
+	PageSize int         `yaml:"page_size" json:"page_size"`
+	Total    int         `yaml:"total" json:"total"`
+}
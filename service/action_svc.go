@@ -1,20 +1,243 @@
 package service
 
 import (
+	"context"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"oss.nandlabs.io/golly/l3"
 	"oss.nandlabs.io/golly/lifecycle"
 	"oss.nandlabs.io/orcaloop-sdk/config"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
 	"oss.nandlabs.io/orcaloop-sdk/service/api"
+	"oss.nandlabs.io/orcaloop-sdk/service/dispatch"
+	"oss.nandlabs.io/orcaloop-sdk/service/outbox"
+)
+
+const (
+	// DefaultShutdownGracePeriod is the default time the running handlers are given to complete when the service stops.
+	DefaultShutdownGracePeriod = 30 * time.Second
+	// DefaultRegistrationInterval is the wait before the actions whose registration failed are registered again.
+	DefaultRegistrationInterval = 5 * time.Second
+	// DefaultAbortTimeout is the time the handlers are given to return once their context is cancelled
+	// after the grace period, before they are reported as failed.
+	DefaultAbortTimeout = 5 * time.Second
 )
 
-var serviceLifecycleManager = lifecycle.NewSimpleComponentManager()
+var logger = l3.Get()
+
+var (
+	stopMu   sync.Mutex
+	stopping bool
+	// serviceLifecycleManager holds the components of the running service, a new one is created on every start
+	serviceLifecycleManager = lifecycle.NewSimpleComponentManager()
+	gracePeriod             = DefaultShutdownGracePeriod
+	svcClient               *OrcaloopClient
+)
 
+// Start starts the action service and blocks until it stops.
+// The results of asynchronous actions are reported using a client of the OrcaloopURL of the config, if set,
+// through the outbox at the OutboxPath of the config, if set, and signed as per the Signing of the config.
 func Start(c *config.ActionSvcConfig) {
+	var client *OrcaloopClient
+	if c.OrcaloopURL != "" {
+		var opts []ClientOption
+		if c.OutboxPath != "" {
+			ob, err := outbox.Open(c.OutboxPath)
+			if err != nil {
+				panic(err)
+			}
+			opts = append(opts, WithOutbox(ob))
+		}
+		if c.Signing != nil {
+			signer, err := api.NewSigner(c.Signing)
+			if err != nil {
+				panic(err)
+			}
+			opts = append(opts, WithSigner(signer))
+		}
+		client = NewClient(c.OrcaloopURL, opts...)
+	}
+	StartWithClient(c, client)
+}
+
+// StartWithClient starts the action service and blocks until it stops.
+// The client registers the actions of the ActionRegistry with the Orcaloop server and reports the results
+// of asynchronous actions, asynchronous actions are rejected if it is nil.
+// The service stops gracefully, as done by Stop, when the process receives SIGTERM or an interrupt.
+func StartWithClient(c *config.ActionSvcConfig, client *OrcaloopClient) {
+	stopMu.Lock()
+	stopping = false
+	gracePeriod = DefaultShutdownGracePeriod
+	if c.ShutdownGracePeriod > 0 {
+		gracePeriod = time.Duration(c.ShutdownGracePeriod) * time.Millisecond
+	}
+	svcClient = client
+	manager := lifecycle.NewSimpleComponentManager()
+	serviceLifecycleManager = manager
+	stopMu.Unlock()
+	dispatch.Open()
+	// the actions are registered with the server as the service starts, it is ready once they are all acknowledged
+	dispatch.RequireAcknowledgement(client != nil)
+	dispatch.SetQuarantineThreshold(c.QuarantineAfter)
+	if c.Executor != nil {
+		dispatch.ConfigureExecutor(c.Executor.MaxInFlight, c.Executor.QueueDepth, c.Executor.ActionLimits)
+	}
+	if client != nil {
+		manager.Register(registrationComponent(client))
+		manager.Register(asyncComponent(c.Async, client))
+		if client.outbox != nil {
+			manager.Register(outboxComponent(client.outbox))
+		}
+	}
 	//prepare the server
-	api.PrepareServer(serviceLifecycleManager, c)
+	api.PrepareServer(manager, c)
+	// stop gracefully on SIGTERM, sent by kubernetes before a pod is removed
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	stopped := make(chan struct{})
+	defer close(stopped)
+	defer signal.Stop(signals)
+	go func() {
+		select {
+		case sig := <-signals:
+			logger.InfoF("Received %v, stopping the action service", sig)
+			Stop()
+		case <-stopped:
+		}
+	}()
 	//start the server
-	serviceLifecycleManager.StartAndWait()
+	manager.StartAndWait()
 }
 
+// Stop stops the action service gracefully.
+// New invocations are rejected while the running and queued handlers are given the configured
+// ShutdownGracePeriod to complete. The context of the handlers still running afterwards is cancelled,
+// and the asynchronous invocations that did not complete are reported as failed. The pending events
+// of the outbox are then flushed before the components of the service are stopped.
 func Stop() {
-	serviceLifecycleManager.StopAll()
+	stopMu.Lock()
+	if stopping {
+		stopMu.Unlock()
+		return
+	}
+	stopping = true
+	grace, client, manager := gracePeriod, svcClient, serviceLifecycleManager
+	stopMu.Unlock()
+
+	dispatch.BeginDrain()
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	err := dispatch.Drain(ctx)
+	cancel()
+	if err != nil {
+		logger.WarnF("Handlers still running after the grace period of %v, cancelling them", grace)
+		// cancel the handlers still running and give them a chance to report their failure
+		dispatch.Shutdown()
+		ctx, cancel = context.WithTimeout(context.Background(), DefaultAbortTimeout)
+		err = dispatch.Drain(ctx)
+		cancel()
+		if err != nil {
+			if aborted := dispatch.Abort(dispatch.ErrShutdown); aborted > 0 {
+				logger.WarnF("Reported %d unfinished invocations as failed", aborted)
+			}
+		}
+	}
+	if client != nil && client.outbox != nil {
+		ctx, cancel = context.WithTimeout(context.Background(), DefaultAbortTimeout)
+		if err = client.outbox.Flush(ctx); err != nil {
+			logger.WarnF("%d events pending in the outbox, they are delivered once the service restarts", client.outbox.Pending())
+		}
+		cancel()
+	}
+	// cancel whatever is left before the components are stopped
+	dispatch.Shutdown()
+	manager.StopAll()
+}
+
+// asyncComponent creates the component running the workers of asynchronous actions.
+func asyncComponent(c *config.AsyncConfig, client *OrcaloopClient) lifecycle.Component {
+	var workers, queueSize int
+	var heartbeatInterval time.Duration
+	if c != nil {
+		workers, queueSize = c.Workers, c.QueueSize
+		heartbeatInterval = time.Duration(c.HeartbeatInterval) * time.Millisecond
+	}
+	return &lifecycle.SimpleComponent{
+		CompId: "async-workers",
+		StartFunc: func() error {
+			dispatch.SetHeartbeatInterval(heartbeatInterval)
+			return dispatch.StartAsync(workers, queueSize, client)
+		},
+		StopFunc: func() error {
+			ctx, cancel := context.WithTimeout(context.Background(), DefaultAbortTimeout)
+			defer cancel()
+			return dispatch.StopAsync(ctx)
+		},
+	}
+}
+
+// registrationComponent creates the component registering the actions of the ActionRegistry with the Orcaloop
+// server once the service starts. The actions that are not acknowledged, because they were added to the registry
+// directly or their registration failed, are registered again every DefaultRegistrationInterval until they are.
+func registrationComponent(client *OrcaloopClient) lifecycle.Component {
+	var stop chan struct{}
+	var done chan struct{}
+	return &lifecycle.SimpleComponent{
+		CompId: "action-registration",
+		StartFunc: func() error {
+			stop, done = make(chan struct{}), make(chan struct{})
+			go func(stop, done chan struct{}) {
+				defer close(done)
+				for !registerActions(client) {
+					timer := time.NewTimer(DefaultRegistrationInterval)
+					select {
+					case <-stop:
+						timer.Stop()
+						return
+					case <-timer.C:
+					}
+				}
+			}(stop, done)
+			return nil
+		},
+		StopFunc: func() error {
+			if stop != nil {
+				close(stop)
+				<-done
+				stop = nil
+			}
+			return nil
+		},
+	}
+}
+
+// registerActions registers the actions of the ActionRegistry that are not acknowledged yet.
+// It returns true once all of them are acknowledged.
+func registerActions(client *OrcaloopClient) (registered bool) {
+	registered = true
+	for _, actionHandler := range handlers.ActionRegistry.Items() {
+		if actionHandler == nil || actionHandler.Spec() == nil || dispatch.Acknowledged(actionHandler.Spec().Id) {
+			continue
+		}
+		if err := client.Register(actionHandler); err != nil {
+			logger.ErrorF("Failed to register action %s: %v", actionHandler.Spec().Id, err)
+			registered = false
+		}
+	}
+	return
+}
+
+// outboxComponent creates the component closing the outbox when the service stops.
+// The dispatcher of the outbox is started by the client.
+func outboxComponent(ob *outbox.Outbox) lifecycle.Component {
+	return &lifecycle.SimpleComponent{
+		CompId: "outbox",
+		StartFunc: func() error {
+			return nil
+		},
+		StopFunc: ob.Stop,
+	}
 }
@@ -0,0 +1,61 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/service/dispatch"
+)
+
+func TestRegisterActions(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	handler := handlers.NewHandler(&models.ActionSpec{Id: "registered-action"}, func(ctx context.Context, p *data.Pipeline) error {
+		return nil
+	})
+	handlers.ActionRegistry.Register("registered-action", handler)
+	defer handlers.ActionRegistry.Unregister("registered-action")
+
+	client := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{}), WithCircuitBreaker(nil))
+	if registerActions(client) {
+		t.Fatal("registerActions() = true, want false after a rejected registration")
+	}
+	if dispatch.Acknowledged("registered-action") {
+		t.Fatal("the rejected action is acknowledged")
+	}
+	if !registerActions(client) || !dispatch.Acknowledged("registered-action") {
+		t.Fatal("registerActions() did not register the action again")
+	}
+	// acknowledged actions are not registered again
+	if !registerActions(client) || attempts != 2 {
+		t.Fatalf("registration attempts = %d, want 2", attempts)
+	}
+
+	component := registrationComponent(client)
+	if err := component.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(10 * time.Millisecond)
+	if err := component.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,391 @@
+// Package openapi generates the OpenAPI 3.0 document describing the REST endpoints executing the
+// actions hosted by an action service. The document is derived from the ActionSpecs of the actions,
+// the request and response bodies of every action from the Schemas of its parameters and returns.
+package openapi
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/service/signature"
+)
+
+const (
+	// Version is the version of the OpenAPI specification of the generated documents.
+	Version = "3.0.3"
+	// ActionPathPrefix is the path of the endpoint executing an action, without its id.
+	ActionPathPrefix = "/api/v1/actions/"
+	// ContentTypeJSON is the content type of the request and response bodies.
+	ContentTypeJSON = "application/json"
+	// ErrorSchemaName is the name of the component describing models.Error.
+	ErrorSchemaName = "Error"
+	// FailureEventSchemaName is the name of the component describing the failure events of the actions.
+	FailureEventSchemaName = "FailureEvent"
+	// SignatureSchemeName is the name of the security scheme describing the HMAC signatures of the requests.
+	SignatureSchemeName = "OrcaloopSignature"
+)
+
+// Document is an OpenAPI 3.0 document.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Info       *Info                `json:"info"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components *Components          `json:"components,omitempty"`
+}
+
+// Info is the metadata of the API.
+type Info struct {
+	Title       string `json:"title"`
+	Description string `json:"description,omitempty"`
+	Version     string `json:"version"`
+}
+
+// PathItem describes the operations available on a path.
+type PathItem struct {
+	Post *Operation `json:"post,omitempty"`
+}
+
+// Operation describes an operation of a path.
+type Operation struct {
+	OperationId string                `json:"operationId,omitempty"`
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []*Parameter          `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter describes a parameter of an operation.
+type Parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required,omitempty"`
+	Schema      *Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body of a request.
+type RequestBody struct {
+	Description string                `json:"description,omitempty"`
+	Required    bool                  `json:"required,omitempty"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+// Response describes a response of an operation.
+type Response struct {
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content,omitempty"`
+}
+
+// MediaType describes the body of a content type.
+type MediaType struct {
+	Schema *Schema `json:"schema,omitempty"`
+}
+
+// Components holds the schemas and security schemes referenced by the document.
+type Components struct {
+	Schemas         map[string]*Schema         `json:"schemas,omitempty"`
+	SecuritySchemes map[string]*SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// SecurityScheme describes how the requests are authenticated.
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Description string `json:"description,omitempty"`
+	Name        string `json:"name,omitempty"`
+	In          string `json:"in,omitempty"`
+}
+
+// Schema is an OpenAPI schema object.
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	OneOf                []*Schema          `json:"oneOf,omitempty"`
+}
+
+// Generate generates the document describing the endpoints executing the actions.
+// Every action has a POST operation on ActionPathPrefix followed by its id. If the requests
+// are signed, the operations require the SignatureSchemeName security scheme and the
+// timestamp and signature headers, and respond with 401 Unauthorized to unsigned requests.
+//
+// Parameters:
+//   - title: The title of the API, usually the name of the action service.
+//   - version: The version of the API.
+//   - specs: The specs of the actions.
+//   - signed: Whether the requests executing the actions must be signed.
+//
+// Returns:
+//   - *Document: The generated document.
+func Generate(title, version string, specs []*models.ActionSpec, signed bool) *Document {
+	doc := &Document{
+		OpenAPI: Version,
+		Info: &Info{
+			Title:   title,
+			Version: version,
+		},
+		Paths: make(map[string]*PathItem, len(specs)),
+		Components: &Components{
+			Schemas: map[string]*Schema{
+				ErrorSchemaName:        errorSchema(),
+				FailureEventSchemaName: eventSchema(&Schema{Type: "object", AdditionalProperties: true}),
+			},
+		},
+	}
+	if signed {
+		doc.Components.SecuritySchemes = map[string]*SecurityScheme{
+			SignatureSchemeName: {
+				Type: "apiKey",
+				Description: "The hex encoded HMAC-SHA256, prefixed by " + signature.SchemeV1 + ", of the timestamp, method, path, " +
+					"raw query and body of the request separated by new lines, keyed by a shared secret.",
+				Name: signature.SignatureHeader,
+				In:   "header",
+			},
+		}
+	}
+	for _, spec := range specs {
+		if spec == nil {
+			continue
+		}
+		op := operation(spec)
+		if signed {
+			sign(op)
+		}
+		doc.Paths[ActionPathPrefix+spec.Id] = &PathItem{Post: op}
+	}
+	return doc
+}
+
+// SchemaOf converts the schema of a parameter or return value of an action to an OpenAPI schema.
+//
+// Parameters:
+//   - schema: The schema of the value.
+//
+// Returns:
+//   - *Schema: The OpenAPI schema, without type if the type of the value is unknown.
+func SchemaOf(schema *models.Schema) *Schema {
+	if schema == nil {
+		return &Schema{}
+	}
+	s := &Schema{
+		Description: schema.Description,
+		Default:     schema.Default,
+		Enum:        enumValues(schema.Enum),
+	}
+	switch schema.Type {
+	case models.FieldTypeString:
+		s.Type = "string"
+	case models.FieldTypeDateStr:
+		s.Type, s.Format = "string", "date-time"
+	case models.FieldTypeInt:
+		s.Type, s.Format = "integer", "int32"
+	case models.FieldTypeInt64:
+		s.Type, s.Format = "integer", "int64"
+	case models.FieldTypeByte:
+		min, max := float64(0), float64(math.MaxUint8)
+		s.Type, s.Minimum, s.Maximum = "integer", &min, &max
+	case models.FieldTypeFloat32:
+		s.Type, s.Format = "number", "float"
+	case models.FieldTypeFloat64:
+		s.Type, s.Format = "number", "double"
+	case models.FieldTypeBool:
+		s.Type = "boolean"
+	case models.FieldTypeArray:
+		s.Type = "array"
+		s.Items = SchemaOf(schema.Items)
+	case models.FieldTypeObject:
+		s.Type = "object"
+		if len(schema.Properties) == 0 {
+			s.AdditionalProperties = true
+		} else {
+			s.Properties, s.Required = properties(schema.Properties)
+		}
+	}
+	return s
+}
+
+// operation describes the execution of the action.
+func operation(spec *models.ActionSpec) *Operation {
+	input := &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			data.InstanceIdKey: {Type: "string", Description: "The id of the workflow instance invoking the action."},
+			data.StepIdKey:     {Type: "string", Description: "The id of the step invoking the action."},
+			data.WorkflowIdKey: {Type: "string", Description: "The id of the workflow invoking the action."},
+		},
+		Required:             []string{data.InstanceIdKey, data.StepIdKey},
+		AdditionalProperties: true,
+	}
+	if spec.Async {
+		// the result of an asynchronous action is reported with the workflow id
+		input.Required = append(input.Required, data.WorkflowIdKey)
+	}
+	params, required := properties(spec.Parameters)
+	for name, s := range params {
+		input.Properties[name] = s
+	}
+	input.Required = append(input.Required, required...)
+
+	op := &Operation{
+		OperationId: operationId(spec.Id),
+		Summary:     spec.Name,
+		Description: spec.Description,
+		Tags:        []string{"actions"},
+		RequestBody: &RequestBody{
+			Description: "The parameters of the action and the step invoking it.",
+			Required:    true,
+			Content:     jsonContent(input),
+		},
+		Responses: map[string]*Response{
+			"400": errorResponse("The request or the parameters of the action are invalid."),
+			"404": errorResponse("The action is not hosted by the service."),
+			"429": errorResponse("Too many invocations are waiting to run."),
+			"500": {
+				Description: "The action failed.",
+				Content:     jsonContent(&Schema{OneOf: []*Schema{ref(ErrorSchemaName), ref(FailureEventSchemaName)}}),
+			},
+			"503": {
+				Description: "The action is quarantined or the service is stopping.",
+				Content:     jsonContent(&Schema{OneOf: []*Schema{ref(ErrorSchemaName), ref(FailureEventSchemaName)}}),
+			},
+		},
+	}
+	if spec.Async {
+		op.Responses["202"] = &Response{Description: "The action was accepted, its result is reported to the Orcaloop server once it completes."}
+	} else {
+		output := &Schema{Type: "object", AdditionalProperties: true}
+		output.Properties, _ = properties(spec.Returns)
+		op.Responses["200"] = &Response{
+			Description: "The action completed.",
+			Content:     jsonContent(eventSchema(output)),
+		}
+	}
+	return op
+}
+
+// sign requires the signature of the requests of the operation.
+func sign(op *Operation) {
+	op.Security = []map[string][]string{{SignatureSchemeName: {}}}
+	op.Parameters = append(op.Parameters,
+		&Parameter{
+			Name:        signature.TimestampHeader,
+			In:          "header",
+			Description: "The unix time, in seconds, at which the request was signed.",
+			Required:    true,
+			Schema:      &Schema{Type: "integer", Format: "int64"},
+		},
+		&Parameter{
+			Name:        signature.SignatureHeader,
+			In:          "header",
+			Description: "The comma separated signatures of the request.",
+			Required:    true,
+			Schema:      &Schema{Type: "string"},
+		},
+	)
+	op.Responses["401"] = errorResponse("The signature of the request is missing, invalid or expired.")
+	op.Responses["413"] = errorResponse("The body of the request is too large to verify its signature.")
+}
+
+// properties converts the schemas to the properties of an object and the names of the required ones.
+// Properties with a default value are not required, the default is applied when they are missing.
+func properties(schemas []*models.Schema) (props map[string]*Schema, required []string) {
+	props = make(map[string]*Schema, len(schemas))
+	for _, schema := range schemas {
+		if schema == nil || schema.Name == "" {
+			continue
+		}
+		props[schema.Name] = SchemaOf(schema)
+		if schema.Required && schema.Default == nil {
+			required = append(required, schema.Name)
+		}
+	}
+	sort.Strings(required)
+	return
+}
+
+// eventSchema describes the step change event responded by the action service with the data.
+func eventSchema(dataSchema *Schema) *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"event_id":    {Type: "string"},
+			"instance_id": {Type: "string"},
+			"step_id":     {Type: "string"},
+			"status":      {Type: "integer", Description: "The status of the step."},
+			"data":        dataSchema,
+			"error":       ref(ErrorSchemaName),
+		},
+	}
+}
+
+// errorSchema describes models.Error.
+func errorSchema() *Schema {
+	return &Schema{
+		Type: "object",
+		Properties: map[string]*Schema{
+			"code":    {Type: "string"},
+			"message": {Type: "string"},
+			"details": {Type: "string"},
+		},
+		Required: []string{"code", "message"},
+	}
+}
+
+func errorResponse(description string) *Response {
+	return &Response{
+		Description: description,
+		Content:     jsonContent(ref(ErrorSchemaName)),
+	}
+}
+
+func jsonContent(schema *Schema) map[string]*MediaType {
+	return map[string]*MediaType{ContentTypeJSON: {Schema: schema}}
+}
+
+func ref(name string) *Schema {
+	return &Schema{Ref: "#/components/schemas/" + name}
+}
+
+// enumValues converts the enum of a schema, usually a slice, to the values of an OpenAPI enum.
+func enumValues(enum any) []any {
+	if enum == nil {
+		return nil
+	}
+	values, err := data.ToSlice(enum)
+	if err != nil {
+		values = []any{enum}
+	}
+	return values
+}
+
+// operationId derives the id of the operation executing the action. Letters and digits are kept
+// and every other byte, including '_', is escaped as '_' followed by its two hex digits, so that
+// distinct action ids always have distinct operation ids.
+func operationId(actionId string) string {
+	var b strings.Builder
+	b.WriteString("execute_")
+	for i := 0; i < len(actionId); i++ {
+		c := actionId[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "_%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,94 @@
+package openapi
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/service/signature"
+)
+
+func TestOperationId(t *testing.T) {
+	tests := []struct {
+		actionId string
+		want     string
+	}{
+		{actionId: "sendEmail", want: "execute_sendEmail"},
+		{actionId: "a.b", want: "execute_a_2Eb"},
+		{actionId: "a_b", want: "execute_a_5Fb"},
+		{actionId: "a-b", want: "execute_a_2Db"},
+		{actionId: "é", want: "execute__C3_A9"},
+	}
+	for _, tt := range tests {
+		if got := operationId(tt.actionId); got != tt.want {
+			t.Errorf("operationId(%q) = %q, want %q", tt.actionId, got, tt.want)
+		}
+	}
+}
+
+func TestGenerate(t *testing.T) {
+	specs := []*models.ActionSpec{
+		{
+			Id:   "a.b",
+			Name: "Sync",
+			Parameters: []*models.Schema{
+				{Name: "count", Type: models.FieldTypeInt64, Required: true},
+				{Name: "mode", Type: models.FieldTypeString, Required: true, Default: "fast"},
+			},
+			Returns: []*models.Schema{{Name: "total", Type: models.FieldTypeFloat64}},
+		},
+		{Id: "a_b", Async: true},
+		nil,
+	}
+	doc := Generate("service", "v1", specs, false)
+	if len(doc.Paths) != 2 {
+		t.Fatalf("Generate() paths = %d, want 2", len(doc.Paths))
+	}
+	syncOp := doc.Paths[ActionPathPrefix+"a.b"].Post
+	asyncOp := doc.Paths[ActionPathPrefix+"a_b"].Post
+	if syncOp.OperationId == asyncOp.OperationId {
+		t.Fatalf("operation ids collide: %q", syncOp.OperationId)
+	}
+	input := syncOp.RequestBody.Content[ContentTypeJSON].Schema
+	if input.Properties["count"].Format != "int64" || !reflect.DeepEqual(input.Required[2:], []string{"count"}) {
+		t.Fatalf("request schema = %+v, want count required and mode defaulted", input)
+	}
+	if asyncInput := asyncOp.RequestBody.Content[ContentTypeJSON].Schema; asyncInput.Required[len(asyncInput.Required)-1] != data.WorkflowIdKey {
+		t.Fatalf("async request schema required = %v, want the workflow id", asyncInput.Required)
+	}
+	if syncOp.Responses["200"] == nil || syncOp.Responses["202"] != nil || asyncOp.Responses["202"] == nil || asyncOp.Responses["200"] != nil {
+		t.Fatal("the responses do not match the sync and async actions")
+	}
+	if syncOp.Security != nil || syncOp.Responses["401"] != nil || doc.Components.SecuritySchemes != nil {
+		t.Fatal("an unsigned document requires signatures")
+	}
+	if _, err := json.Marshal(doc); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateSigned(t *testing.T) {
+	doc := Generate("service", "v1", []*models.ActionSpec{{Id: "action"}}, true)
+	scheme := doc.Components.SecuritySchemes[SignatureSchemeName]
+	if scheme == nil || scheme.In != "header" || scheme.Name != signature.SignatureHeader {
+		t.Fatalf("security scheme = %+v", scheme)
+	}
+	op := doc.Paths[ActionPathPrefix+"action"].Post
+	if !reflect.DeepEqual(op.Security, []map[string][]string{{SignatureSchemeName: {}}}) {
+		t.Fatalf("security = %v", op.Security)
+	}
+	headers := make(map[string]bool)
+	for _, p := range op.Parameters {
+		if p.In == "header" && p.Required {
+			headers[p.Name] = true
+		}
+	}
+	if !headers[signature.TimestampHeader] || !headers[signature.SignatureHeader] {
+		t.Fatalf("parameters = %v, want the signature headers", headers)
+	}
+	if op.Responses["401"] == nil || op.Responses["413"] == nil {
+		t.Fatal("the signed operation does not describe the rejected requests")
+	}
+}
@@ -1,10 +1,13 @@
 package api
 
 import (
+	"time"
+
 	"oss.nandlabs.io/golly/lifecycle"
 	"oss.nandlabs.io/golly/rest"
 	"oss.nandlabs.io/orcaloop-sdk/config"
 	v1 "oss.nandlabs.io/orcaloop-sdk/service/api/v1"
+	"oss.nandlabs.io/orcaloop-sdk/service/signature"
 )
 
 func PrepareServer(serviceLifecycleManager lifecycle.ComponentManager, c *config.ActionSvcConfig) {
@@ -30,7 +33,35 @@ func PrepareServer(serviceLifecycleManager lifecycle.ComponentManager, c *config
 	}
 
 	// Register all Handlers
-	srv.Post("v1/actions/:actionId", v1.ExecuteAction)
+	executeAction := rest.HandlerFunc(v1.ExecuteAction)
+	if c.Signing != nil {
+		var signer *signature.Signer
+		signer, err = NewSigner(c.Signing)
+		if err != nil {
+			panic(err)
+		}
+		executeAction = v1.VerifySignature(signer, c.Signing.MaxBodySize, executeAction)
+	}
+	srv.Post("v1/actions/:actionId", executeAction)
+	srv.Get("v1/executor", v1.GetExecutorGauges)
+	srv.Get("v1/actions", v1.ListActions)
+	srv.Get("v1/actions/:actionId", v1.GetAction)
+	srv.Get("openapi.json", v1.GetOpenAPI(c.Name, c.Signing != nil))
+	// probes of the orchestrators
+	srv.Get("health", v1.GetHealth)
+	srv.Get("ready", v1.GetReadiness)
 	//register the server with the lifecycle manager
 	serviceLifecycleManager.Register(srv)
 }
+
+// NewSigner creates the signer of the requests exchanged with the Orcaloop server from the config.
+//
+// Parameters:
+//   - c: The signing config.
+//
+// Returns:
+//   - *signature.Signer: The signer.
+//   - error: signature.ErrNoSecret if the config has no secret.
+func NewSigner(c *config.SigningConfig) (*signature.Signer, error) {
+	return signature.NewSigner(c.Secrets, time.Duration(c.Tolerance)*time.Millisecond)
+}
@@ -1,18 +1,25 @@
 package v1
 
 import (
+	"context"
+	"errors"
 	"net/http"
+	"sort"
 
 	"oss.nandlabs.io/golly/rest"
 	"oss.nandlabs.io/orcaloop-sdk/data"
 	"oss.nandlabs.io/orcaloop-sdk/events"
 	"oss.nandlabs.io/orcaloop-sdk/handlers"
 	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/service/api/openapi"
+	"oss.nandlabs.io/orcaloop-sdk/service/dispatch"
 	"oss.nandlabs.io/orcaloop-sdk/utils"
 )
 
 const (
 	ActionIDParam = "actionId"
+	// APIVersion is the version of the API of the action service
+	APIVersion = "v1"
 )
 
 var transformError = func(code int, message string) *models.Error {
@@ -31,7 +38,7 @@ func ExecuteAction(ctx rest.ServerContext) {
 		return
 	}
 
-	actionHandler = handlers.ActionRegistry.Get(actionId)
+	actionHandler = handlers.Resolve(actionId)
 	if actionHandler == nil {
 		ctx.SetStatusCode(http.StatusNotFound)
 		ctx.WriteJSON(transformError(http.StatusNotFound, "Action not found"))
@@ -58,29 +65,164 @@ func ExecuteAction(ctx rest.ServerContext) {
 	}
 
 	pipeline := data.NewPipelineFrom(input)
-	err = actionHandler.Handle(pipeline)
+	utils.ApplyDefaults(actionHandler.Spec(), pipeline)
+	err = pipeline.Coerce(actionHandler.Spec().Parameters)
 	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		ctx.WriteJSON(transformError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	if _, err = utils.ValidateInputs(actionHandler.Spec(), pipeline); err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		ctx.WriteJSON(transformError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	request := ctx.GetRequest()
+	requestCtx := handlers.WithMetadata(request.Context(), requestMetadata(request))
+	if actionHandler.Spec().Async {
+		executeAsync(ctx, requestCtx, actionId, actionHandler, pipeline)
+		return
+	}
+	waitCtx, cancelWait := dispatch.Context(requestCtx, nil)
+	defer cancelWait()
+	release, err := dispatch.Acquire(waitCtx, actionId, false)
+	if errors.Is(err, dispatch.ErrExecutorFull) {
+		ctx.SetStatusCode(http.StatusTooManyRequests)
+		ctx.WriteJSON(transformError(http.StatusTooManyRequests, err.Error()))
+		return
+	} else if err != nil {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.WriteJSON(transformError(http.StatusServiceUnavailable, err.Error()))
+		return
+	}
+	defer release()
+	handlerCtx, cancel := dispatch.Context(requestCtx, actionHandler.Spec())
+	defer cancel()
+	err = dispatch.Invoke(handlerCtx, actionId, actionHandler, pipeline)
+	var panicErr *handlers.PanicError
+	var quarantinedErr *dispatch.QuarantinedError
+	if errors.As(err, &panicErr) {
+		ctx.SetStatusCode(http.StatusInternalServerError)
+		ctx.WriteJSON(dispatch.FailureEvent(pipeline, err, models.ErrCodeActionPanic))
+		return
+	} else if errors.As(err, &quarantinedErr) {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.WriteJSON(dispatch.FailureEvent(pipeline, err, models.ErrCodeActionQuarantined))
+		return
+	} else if err != nil {
 		ctx.SetStatusCode(http.StatusInternalServerError)
 		ctx.WriteJSON(transformError(http.StatusInternalServerError, err.Error()))
 		return
 	} else {
 
-		if actionHandler.Spec().Async {
-			ctx.SetStatusCode(http.StatusAccepted)
-		} else {
+		ctx.SetStatusCode(http.StatusOK)
+		response := &events.StepChangeEvent{
+			EventId:    utils.GenerateId(),
+			InstanceId: instanceId,
+			StepId:     stepId,
+			Status:     models.StatusCompleted,
+			Data:       pipeline.Map(),
+		}
+		ctx.WriteJSON(response)
+
+		return
+	}
+}
+
+// executeAsync submits an asynchronous action with validated inputs to the workers.
+// It responds with 202 Accepted without waiting for the handler, its result is reported
+// to the Orcaloop server once it completes. The result is reported with the workflow id,
+// so requests without one are rejected before the handler runs.
+func executeAsync(ctx rest.ServerContext, requestCtx context.Context, actionId string, actionHandler handlers.ActionHandler, pipeline *data.Pipeline) {
+	if workflowId, err := pipeline.GetString(data.WorkflowIdKey); err != nil || workflowId == "" {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		ctx.WriteJSON(transformError(http.StatusBadRequest, "Workflow Id is required"))
+		return
+	}
+	if dispatch.IsQuarantined(actionId) {
+		err := &dispatch.QuarantinedError{ActionId: actionId, Panics: dispatch.Panics(actionId)}
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.WriteJSON(dispatch.FailureEvent(pipeline, err, models.ErrCodeActionQuarantined))
+		return
+	}
+	err := dispatch.Submit(requestCtx, actionId, actionHandler, pipeline)
+	switch {
+	case errors.Is(err, dispatch.ErrAsyncQueueFull):
+		ctx.SetStatusCode(http.StatusTooManyRequests)
+		ctx.WriteJSON(transformError(http.StatusTooManyRequests, err.Error()))
+	case err != nil:
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+		ctx.WriteJSON(transformError(http.StatusServiceUnavailable, err.Error()))
+	default:
+		ctx.SetStatusCode(http.StatusAccepted)
+	}
+}
+
+// requestMetadata collects the headers of the request as the metadata of the invocation.
+func requestMetadata(request *http.Request) handlers.Metadata {
+	md := make(handlers.Metadata, len(request.Header))
+	for k := range request.Header {
+		md[k] = request.Header.Get(k)
+	}
+	return md
+}
+
+// GetExecutorGauges responds with the in-flight and queued work of the action service.
+func GetExecutorGauges(ctx rest.ServerContext) {
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.WriteJSON(dispatch.ExecutorGauges())
+}
+
+// ListActions responds with the specs of the actions hosted by the action service, sorted by id.
+func ListActions(ctx rest.ServerContext) {
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.WriteJSON(actionSpecs())
+}
 
-			ctx.SetStatusCode(http.StatusOK)
-			response := &events.StepChangeEvent{
-				EventId:    utils.GenerateId(),
-				InstanceId: instanceId,
-				StepId:     stepId,
-				Status:     models.StatusCompleted,
-				Data:       pipeline.Map(),
-			}
-			ctx.WriteJSON(response)
+// GetOpenAPI creates the handler responding with the OpenAPI document of the actions hosted by the action service.
+// The document is generated on every request, so that it reflects the actions registered since the service started.
+//
+// Parameters:
+//   - title: The title of the document, usually the name of the action service.
+//   - signed: Whether the requests executing the actions must be signed.
+//
+// Returns:
+//   - rest.HandlerFunc: The handler.
+func GetOpenAPI(title string, signed bool) rest.HandlerFunc {
+	return func(ctx rest.ServerContext) {
+		ctx.SetStatusCode(http.StatusOK)
+		ctx.WriteJSON(openapi.Generate(title, APIVersion, actionSpecs(), signed))
+	}
+}
 
+// actionSpecs returns the specs of the actions of the ActionRegistry, sorted by id.
+func actionSpecs() []*models.ActionSpec {
+	specs := make([]*models.ActionSpec, 0)
+	for _, actionHandler := range handlers.ActionRegistry.Items() {
+		if actionHandler != nil && actionHandler.Spec() != nil {
+			specs = append(specs, actionHandler.Spec())
 		}
+	}
+	sort.Slice(specs, func(i, j int) bool {
+		return specs[i].Id < specs[j].Id
+	})
+	return specs
+}
 
+// GetAction responds with the spec of the action.
+func GetAction(ctx rest.ServerContext) {
+	actionId, err := ctx.GetParam(ActionIDParam, rest.PathParam)
+	if err != nil {
+		ctx.SetStatusCode(http.StatusBadRequest)
+		ctx.WriteJSON(transformError(http.StatusBadRequest, err.Error()))
+		return
+	}
+	actionHandler := handlers.ActionRegistry.Get(actionId)
+	if actionHandler == nil {
+		ctx.SetStatusCode(http.StatusNotFound)
+		ctx.WriteJSON(transformError(http.StatusNotFound, "Action not found"))
 		return
 	}
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.WriteJSON(actionHandler.Spec())
 }
@@ -0,0 +1,32 @@
+package v1
+
+import (
+	"net/http"
+
+	"oss.nandlabs.io/golly/rest"
+	"oss.nandlabs.io/orcaloop-sdk/service/dispatch"
+)
+
+// Health is the liveness of the action service.
+type Health struct {
+	Status string `json:"status"`
+}
+
+// GetHealth responds with 200 OK as long as the action service is serving requests.
+func GetHealth(ctx rest.ServerContext) {
+	ctx.SetStatusCode(http.StatusOK)
+	ctx.WriteJSON(&Health{Status: "UP"})
+}
+
+// GetReadiness responds with 200 OK once every action is acknowledged by the Orcaloop server
+// and every listener is up, and with 503 Service Unavailable otherwise, including while the
+// action service drains.
+func GetReadiness(ctx rest.ServerContext) {
+	readiness := dispatch.CheckReadiness()
+	if readiness.Ready {
+		ctx.SetStatusCode(http.StatusOK)
+	} else {
+		ctx.SetStatusCode(http.StatusServiceUnavailable)
+	}
+	ctx.WriteJSON(readiness)
+}
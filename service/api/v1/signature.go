@@ -0,0 +1,57 @@
+package v1
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+
+	"oss.nandlabs.io/golly/l3"
+	"oss.nandlabs.io/golly/rest"
+	"oss.nandlabs.io/orcaloop-sdk/service/signature"
+)
+
+var logger = l3.Get()
+
+// DefaultMaxBodySize is the default maximum size in bytes of the body of a signed request.
+const DefaultMaxBodySize int64 = 1 << 20
+
+// VerifySignature creates a handler rejecting the requests whose signature is not verified by the signer
+// with 401 Unauthorized before they reach next. The body is read to verify the signature, requests whose
+// body is larger than maxBodySize are rejected with 413 Request Entity Too Large.
+//
+// Parameters:
+//   - signer: The signer holding the active secrets.
+//   - maxBodySize: The maximum size in bytes of the body, DefaultMaxBodySize if not positive.
+//   - next: The handler of the verified requests.
+//
+// Returns:
+//   - rest.HandlerFunc: The handler.
+func VerifySignature(signer *signature.Signer, maxBodySize int64, next rest.HandlerFunc) rest.HandlerFunc {
+	if maxBodySize <= 0 {
+		maxBodySize = DefaultMaxBodySize
+	}
+	return func(ctx rest.ServerContext) {
+		request := ctx.GetRequest()
+		body, err := io.ReadAll(http.MaxBytesReader(nil, request.Body, maxBodySize))
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			ctx.SetStatusCode(http.StatusRequestEntityTooLarge)
+			ctx.WriteJSON(transformError(http.StatusRequestEntityTooLarge, err.Error()))
+			return
+		} else if err != nil {
+			ctx.SetStatusCode(http.StatusBadRequest)
+			ctx.WriteJSON(transformError(http.StatusBadRequest, err.Error()))
+			return
+		}
+		// restore the body for next
+		request.Body = io.NopCloser(bytes.NewReader(body))
+		if err = signer.Verify(request, body); err != nil {
+			logger.WarnF("Rejected request to %s: %v", request.URL.Path, err)
+			ctx.SetStatusCode(http.StatusUnauthorized)
+			ctx.WriteJSON(transformError(http.StatusUnauthorized, err.Error()))
+			return
+		}
+		next(ctx)
+	}
+}
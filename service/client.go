@@ -1,74 +1,249 @@
 package service
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
 	"fmt"
+	"io"
 	"net/http"
 	"strings"
+	"time"
 
+	"oss.nandlabs.io/golly/clients"
 	"oss.nandlabs.io/golly/ioutils"
-	"oss.nandlabs.io/golly/rest"
 	"oss.nandlabs.io/orcaloop-sdk/data"
 	"oss.nandlabs.io/orcaloop-sdk/events"
 	"oss.nandlabs.io/orcaloop-sdk/handlers"
 	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/service/dispatch"
+	"oss.nandlabs.io/orcaloop-sdk/service/outbox"
+	"oss.nandlabs.io/orcaloop-sdk/service/signature"
+	"oss.nandlabs.io/orcaloop-sdk/utils"
 )
 
 const (
 	ActionsEndPoint  = "/api/actions"
 	InstanceEndpoint = "/api/instances/:instanceId/actions/:actionId"
+	ProgressEndpoint = "/api/instances/:instanceId/actions/:actionId/progress"
 )
 
+// OrcaloopClient is the client of the Orcaloop server api.
+//
+// Requests are sent with net/http rather than golly's rest.Client: the client must accept a custom
+// http.RoundTripper and tls.Config (WithTransport, WithTLSConfig) and bind every request to a context
+// so that WaitForCompletion and the shutdown of the service can cancel calls in flight, neither of which
+// rest.Client supports. golly's clients.CircuitBreaker is still used to stop calling a failing server.
 type OrcaloopClient struct {
-	client  *rest.Client
-	baseurl string
+	httpClient *http.Client
+	baseurl    string
+	userAgent  string
+	tlsConfig  *tls.Config
+	auth       AuthProvider
+	retry      RetryPolicy
+	breaker    *clients.CircuitBreaker
+	outbox     *outbox.Outbox
+	signer     *signature.Signer
+	// pollInterval and maxPollInterval bound the wait between two polls of WaitForCompletion
+	pollInterval    time.Duration
+	maxPollInterval time.Duration
 }
 
-func (oc *OrcaloopClient) Register(actionHandler handlers.ActionHandler) (err error) {
-	var res *rest.Response
-	var req *rest.Request
-	req, err = oc.client.NewRequest(oc.baseurl+ActionsEndPoint, http.MethodPost)
+// NewClient creates a new OrcaloopClient for the Orcaloop server at the base url.
+//
+// Parameters:
+//   - baseURL: The base url of the Orcaloop server, e.g. https://orcaloop.example.com.
+//   - opts: The options configuring the client.
+//
+// Returns:
+//   - *OrcaloopClient: A new OrcaloopClient instance.
+func NewClient(baseURL string, opts ...ClientOption) *OrcaloopClient {
+	oc := &OrcaloopClient{
+		httpClient: &http.Client{
+			Timeout: DefaultClientTimeout,
+		},
+		baseurl:         strings.TrimSuffix(baseURL, "/"),
+		userAgent:       DefaultUserAgent,
+		retry:           DefaultRetryPolicy,
+		pollInterval:    DefaultPollInterval,
+		maxPollInterval: DefaultMaxPollInterval,
+		breaker:         clients.NewCB(&DefaultBreakerInfo),
+	}
+	for _, opt := range opts {
+		opt(oc)
+	}
+	if oc.tlsConfig != nil {
+		switch transport := oc.httpClient.Transport.(type) {
+		case nil:
+			defaultTransport := http.DefaultTransport.(*http.Transport).Clone()
+			defaultTransport.TLSClientConfig = oc.tlsConfig
+			oc.httpClient.Transport = defaultTransport
+		case *http.Transport:
+			transport = transport.Clone()
+			transport.TLSClientConfig = oc.tlsConfig
+			oc.httpClient.Transport = transport
+		}
+	}
+	if oc.outbox != nil {
+		// deliver the events left over by a previous run
+		oc.outbox.Start(oc.deliver)
+	}
+	return oc
+}
+
+// response is a response of the Orcaloop server with its body read.
+type response struct {
+	statusCode int
+	status     string
+	header     http.Header
+	body       []byte
+}
+
+// decode decodes the JSON body of the response into v.
+func (r *response) decode(v any) error {
+	return json.Unmarshal(r.body, v)
+}
+
+// statusError returns an error describing an unexpected status of the response.
+func (r *response) statusError() error {
+	return fmt.Errorf("unexpected response from orcaloop server: %s", r.status)
+}
+
+// execute sends a request with the JSON encoded body to the path of the Orcaloop server.
+// Requests are authenticated with the AuthProvider, rejected with ErrCircuitOpen while the
+// circuit breaker is open and retried as per the RetryPolicy of the client.
+// The response of the last attempt is returned once the retries are exhausted.
+// Requests whose method is not idempotent carry an Idempotency-Key header, the same on every attempt,
+// so that the server can recognize a retried request it already processed.
+func (oc *OrcaloopClient) execute(ctx context.Context, method, path string, body any) (res *response, err error) {
+	var payload []byte
+	if body != nil {
+		payload, err = json.Marshal(body)
+		if err != nil {
+			return
+		}
+	}
+	key := idempotencyKey(ctx)
+	if key == "" && !idempotent(method) {
+		key = utils.GenerateId()
+	}
+	for attempt := 0; ; attempt++ {
+		res, err = oc.send(ctx, method, path, payload, key)
+		if attempt >= oc.retry.MaxRetries || ctx.Err() != nil {
+			return
+		}
+		retry, retryAfter := retryable(res, err)
+		if !retry {
+			return
+		}
+		wait := oc.retry.backoff(attempt + 1)
+		if retryAfter > wait {
+			wait = retryAfter
+		}
+		if oc.retry.MaxBackoff > 0 && wait > oc.retry.MaxBackoff {
+			wait = oc.retry.MaxBackoff
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// send sends a single request to the Orcaloop server.
+func (oc *OrcaloopClient) send(ctx context.Context, method, path string, payload []byte, key string) (res *response, err error) {
+	if oc.breaker != nil {
+		if cbErr := oc.breaker.CanExecute(); cbErr != nil {
+			err = fmt.Errorf("%w: %v", ErrCircuitOpen, cbErr)
+			return
+		}
+	}
+	var req *http.Request
+	var reqBody io.Reader
+	if payload != nil {
+		reqBody = bytes.NewReader(payload)
+	}
+	req, err = http.NewRequestWithContext(ctx, method, oc.baseurl+path, reqBody)
 	if err != nil {
 		return
 	}
-	req.SetContentType(ioutils.MimeApplicationJSON)
-	req.SetBody(actionHandler.Spec())
-	res, err = oc.client.Execute(req)
+	if payload != nil {
+		req.Header.Set("Content-Type", ioutils.MimeApplicationJSON)
+	}
+	req.Header.Set("Accept", ioutils.MimeApplicationJSON)
+	if oc.userAgent != "" {
+		req.Header.Set("User-Agent", oc.userAgent)
+	}
+	if key != "" {
+		req.Header.Set(IdempotencyKeyHeader, key)
+	}
+	if oc.auth != nil {
+		if err = oc.auth.Authorize(req); err != nil {
+			return
+		}
+	}
+	if oc.signer != nil {
+		oc.signer.Sign(req, payload)
+	}
+	var httpRes *http.Response
+	httpRes, err = oc.httpClient.Do(req)
+	if err == nil {
+		defer httpRes.Body.Close()
+		res = &response{
+			statusCode: httpRes.StatusCode,
+			status:     httpRes.Status,
+			header:     httpRes.Header,
+		}
+		res.body, err = io.ReadAll(httpRes.Body)
+	}
+	if oc.breaker != nil {
+		oc.breaker.OnExecution(err == nil && res.statusCode < http.StatusInternalServerError)
+	}
+	return
+}
+
+// Register registers the action with the Orcaloop server and, once accepted, in the ActionRegistry.
+//
+// Parameters:
+//   - actionHandler: The handler of the action.
+//
+// Returns:
+//
+//	An error if the registration failed.
+func (oc *OrcaloopClient) Register(actionHandler handlers.ActionHandler) (err error) {
+	var res *response
+	res, err = oc.execute(context.Background(), http.MethodPost, ActionsEndPoint, actionHandler.Spec())
 	if err != nil {
 		return
 	}
-	switch res.StatusCode() {
+	switch res.statusCode {
 	case http.StatusCreated:
 		err = nil
 	case http.StatusInternalServerError:
 		var errorResponse *models.Error
-		err = res.Decode(&errorResponse)
+		err = res.decode(&errorResponse)
 		if err == nil {
 			err = fmt.Errorf("registration of action failed with error code %s and message %s", errorResponse.Code, errorResponse.Message)
 		}
 	default:
-		err = res.GetError()
+		err = res.statusError()
 	}
 
 	if err == nil {
 		handlers.ActionRegistry.Register(actionHandler.Spec().Id, actionHandler)
+		dispatch.Acknowledge(actionHandler.Spec().Id)
 	}
 	return
 }
 
 func (oc *OrcaloopClient) Respond(actionSpec models.ActionSpec, pipeline *data.Pipeline) (err error) {
-	var res *rest.Response
-	var req *rest.Request
 	var stepId, instanceId, workflowId string
 	var status models.Status
 	instanceId = pipeline.Id()
-	endpoint := oc.baseurl + InstanceEndpoint
-	endpoint = strings.ReplaceAll(endpoint, ":instanceId", instanceId)
-	endpoint = strings.ReplaceAll(endpoint, ":actionId", actionSpec.Id)
-	req, err = oc.client.NewRequest(endpoint, http.MethodPost)
-	if err != nil {
-		return
-	}
-	req.SetContentType(ioutils.MimeApplicationJSON)
 	outputData := data.NewPipeline(instanceId)
 	// Set the error response
 	if pipeline.Has(data.StepIdKey) {
@@ -92,6 +267,10 @@ func (oc *OrcaloopClient) Respond(actionSpec models.ActionSpec, pipeline *data.P
 		outputData.Set(data.ErrorKey, pipeline.GetError())
 		status = models.StatusFailed
 
+	} else if _, validationErr := utils.ValidateOutputs(&actionSpec, pipeline); validationErr != nil {
+		// Report outputs that do not match the returns of the action as a failure
+		outputData.Set(data.ErrorKey, "invalid outputs: "+validationErr.Error())
+		status = models.StatusFailed
 	} else {
 
 		// Create a new map to hold the output
@@ -102,32 +281,96 @@ func (oc *OrcaloopClient) Respond(actionSpec models.ActionSpec, pipeline *data.P
 		}
 		status = models.StatusCompleted
 	}
+	// the event id is sent unchanged on every retry so that the server can deduplicate the event
 	event := &events.StepChangeEvent{
+		EventId:    utils.GenerateId(),
 		InstanceId: instanceId,
 		StepId:     stepId,
 		Status:     status,
 		Data:       outputData.Map(),
 	}
+	return oc.RespondEvent(actionSpec.Id, event)
+}
+
+// RespondEvent sends a step change event of an invocation of the action to the Orcaloop server.
+// It is used to report events that are built by the caller, such as the failure of a handler that panicked.
+// An EventId is generated if the event has none, it is sent unchanged on every retry.
+// If the client has an outbox, the event is written to the outbox and delivered in the background.
+//
+// Parameters:
+//   - actionId: The id of the invoked action.
+//   - event: The event to be sent, its InstanceId identifies the workflow instance.
+//
+// Returns:
+//
+//	An error if the event could not be delivered, written to the outbox or was rejected by the server.
+func (oc *OrcaloopClient) RespondEvent(actionId string, event *events.StepChangeEvent) (err error) {
+	if event.EventId == "" {
+		event.EventId = utils.GenerateId()
+	}
+	if oc.outbox != nil {
+		return oc.outbox.Append(actionId, event)
+	}
+	_, err = oc.sendEvent(actionId, event)
+	return
+}
+
+// deliver sends an event of the outbox. Events rejected with a client error other than
+// 408 Request Timeout and 429 Too Many Requests are reported as outbox.ErrPermanent.
+func (oc *OrcaloopClient) deliver(actionId string, event *events.StepChangeEvent) error {
+	res, err := oc.sendEvent(actionId, event)
+	if err != nil && res != nil && res.statusCode >= http.StatusBadRequest && res.statusCode < http.StatusInternalServerError &&
+		res.statusCode != http.StatusRequestTimeout && res.statusCode != http.StatusTooManyRequests {
+		err = fmt.Errorf("%w: %v", outbox.ErrPermanent, err)
+	}
+	return err
+}
 
-	req.SetBody(event)
-	res, err = oc.client.Execute(req)
+// sendEvent sends the event to the Orcaloop server and returns the response, if any.
+func (oc *OrcaloopClient) sendEvent(actionId string, event *events.StepChangeEvent) (res *response, err error) {
+	endpoint := InstanceEndpoint
+	endpoint = strings.ReplaceAll(endpoint, ":instanceId", event.InstanceId)
+	endpoint = strings.ReplaceAll(endpoint, ":actionId", actionId)
+	// the event id identifies the retries of the event
+	res, err = oc.execute(withIdempotencyKey(context.Background(), event.EventId), http.MethodPost, endpoint, event)
 	if err != nil {
 		return
 	}
-	switch res.StatusCode() {
+	switch res.statusCode {
 	case http.StatusOK:
 		err = nil
 	case http.StatusInternalServerError:
 		var errorResponse *models.Error
-		err = res.Decode(&errorResponse)
+		err = res.decode(&errorResponse)
 		if err == nil {
 			err = fmt.Errorf("execution of action failed with error code %s and message %s", errorResponse.Code, errorResponse.Message)
 		} else {
-			err = fmt.Errorf("execution of action failed with error code %d and message %s", res.StatusCode(), res.Status())
+			err = fmt.Errorf("execution of action failed with error code %d and message %s", res.statusCode, res.status)
 		}
 	default:
-		err = res.GetError()
+		err = res.statusError()
 	}
 
 	return
 }
+
+// SendProgress sends a progress or heartbeat event of a running invocation of the action to the Orcaloop server.
+// Handlers report their progress with handlers.ReportProgress, the action service sends the events.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - actionId: The id of the invoked action.
+//   - event: The event to be sent, its InstanceId identifies the workflow instance.
+//
+// Returns:
+//
+//	An error if the event could not be delivered or was rejected by the server.
+func (oc *OrcaloopClient) SendProgress(ctx context.Context, actionId string, event *events.ProgressEvent) error {
+	if event.EventId == "" {
+		event.EventId = utils.GenerateId()
+	}
+	endpoint := ProgressEndpoint
+	endpoint = strings.ReplaceAll(endpoint, ":instanceId", event.InstanceId)
+	endpoint = strings.ReplaceAll(endpoint, ":actionId", actionId)
+	return oc.call(withIdempotencyKey(ctx, event.EventId), http.MethodPost, endpoint, event, nil)
+}
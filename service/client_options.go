@@ -0,0 +1,153 @@
+package service
+
+import (
+	"crypto/tls"
+	"net/http"
+	"time"
+
+	"oss.nandlabs.io/golly/clients"
+	"oss.nandlabs.io/orcaloop-sdk/service/outbox"
+	"oss.nandlabs.io/orcaloop-sdk/service/signature"
+)
+
+const (
+	// DefaultClientTimeout is the default timeout of the requests of the OrcaloopClient.
+	DefaultClientTimeout = 30 * time.Second
+	// DefaultUserAgent is the default User-Agent header of the requests of the OrcaloopClient.
+	DefaultUserAgent = "orcaloop-sdk-go"
+)
+
+// ClientOption configures an OrcaloopClient created with NewClient.
+type ClientOption func(oc *OrcaloopClient)
+
+// AuthProvider authenticates the requests sent by the OrcaloopClient to the Orcaloop server.
+type AuthProvider interface {
+	// Authorize adds the credentials to the request, e.g. as an Authorization header.
+	Authorize(req *http.Request) error
+}
+
+// AuthProviderFunc is a function implementing AuthProvider.
+type AuthProviderFunc func(req *http.Request) error
+
+// Authorize invokes the function.
+func (f AuthProviderFunc) Authorize(req *http.Request) error {
+	return f(req)
+}
+
+// BearerToken returns an AuthProvider sending the token as a bearer token.
+func BearerToken(token string) AuthProvider {
+	return AuthProviderFunc(func(req *http.Request) error {
+		req.Header.Set("Authorization", "Bearer "+token)
+		return nil
+	})
+}
+
+// BasicAuth returns an AuthProvider sending the username and password using HTTP basic authentication.
+func BasicAuth(username, password string) AuthProvider {
+	return AuthProviderFunc(func(req *http.Request) error {
+		req.SetBasicAuth(username, password)
+		return nil
+	})
+}
+
+// WithTimeout sets the timeout of every request, including the reading of the response.
+// Zero means no timeout.
+func WithTimeout(timeout time.Duration) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.httpClient.Timeout = timeout
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used to connect to the Orcaloop server.
+// It applies to the default transport or to a transport set with WithTransport that is an *http.Transport.
+func WithTLSConfig(tlsConfig *tls.Config) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.tlsConfig = tlsConfig
+	}
+}
+
+// WithTransport sets the transport used to send the requests, e.g. to add tracing or a proxy.
+func WithTransport(transport http.RoundTripper) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.httpClient.Transport = transport
+	}
+}
+
+// WithUserAgent sets the User-Agent header of the requests.
+func WithUserAgent(userAgent string) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.userAgent = userAgent
+	}
+}
+
+// WithAuth sets the provider authenticating the requests.
+func WithAuth(provider AuthProvider) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.auth = provider
+	}
+}
+
+// WithRetries retries the failed requests up to maxRetries times, see RetryPolicy.
+// The wait before the first retry is wait and doubles with every retry. Zero retries disables the retries.
+func WithRetries(maxRetries int, wait time.Duration) ClientOption {
+	return func(oc *OrcaloopClient) {
+		policy := DefaultRetryPolicy
+		policy.MaxRetries = maxRetries
+		policy.InitialBackoff = wait
+		oc.retry = policy
+	}
+}
+
+// WithRetryPolicy sets the policy used to retry the failed requests.
+func WithRetryPolicy(policy RetryPolicy) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.retry = policy
+	}
+}
+
+// WithCircuitBreaker stops sending requests to the Orcaloop server once it failed FailureThreshold
+// times in a row, until the Timeout of the breaker elapsed. See clients.BreakerInfo.
+// A nil info disables the circuit breaker, which is enabled with DefaultBreakerInfo by default.
+func WithCircuitBreaker(info *clients.BreakerInfo) ClientOption {
+	return func(oc *OrcaloopClient) {
+		if info == nil {
+			oc.breaker = nil
+			return
+		}
+		oc.breaker = clients.NewCB(info)
+	}
+}
+
+// WithOutbox writes the events sent by Respond and RespondEvent to the outbox before they are delivered.
+// The client starts the dispatcher of the outbox, which delivers the events left over by a previous
+// run and then every event written by the client. Respond returns once the event is written to the outbox.
+func WithOutbox(ob *outbox.Outbox) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.outbox = ob
+	}
+}
+
+// WithPollInterval sets the wait before the first poll of WaitForCompletion and the maximum wait between two polls.
+// Values that are not positive use DefaultPollInterval and DefaultMaxPollInterval.
+func WithPollInterval(interval, maxInterval time.Duration) ClientOption {
+	return func(oc *OrcaloopClient) {
+		if interval <= 0 {
+			interval = DefaultPollInterval
+		}
+		if maxInterval <= 0 {
+			maxInterval = DefaultMaxPollInterval
+		}
+		oc.pollInterval = interval
+		oc.maxPollInterval = maxInterval
+		if oc.maxPollInterval < interval {
+			oc.maxPollInterval = interval
+		}
+	}
+}
+
+// WithSigner signs every request sent to the Orcaloop server with the signer, including the retries.
+func WithSigner(signer *signature.Signer) ClientOption {
+	return func(oc *OrcaloopClient) {
+		oc.signer = signer
+	}
+}
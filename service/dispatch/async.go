@@ -0,0 +1,200 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+const (
+	// DefaultAsyncWorkers is the default number of workers running asynchronous actions.
+	DefaultAsyncWorkers = 8
+	// DefaultAsyncQueueSize is the default number of asynchronous invocations waiting for a worker.
+	DefaultAsyncQueueSize = 64
+)
+
+var ErrAsyncUnavailable = errors.New("asynchronous execution is not available")
+var ErrAsyncQueueFull = errors.New("asynchronous execution queue is full")
+
+// Responder reports the outcome of an asynchronous invocation to the Orcaloop server.
+// It is implemented by service.OrcaloopClient.
+type Responder interface {
+	Respond(actionSpec models.ActionSpec, pipeline *data.Pipeline) error
+}
+
+// asyncTask is an asynchronous invocation waiting for a worker.
+type asyncTask struct {
+	actionId   string
+	handler    handlers.ActionHandler
+	pipeline   *data.Pipeline
+	md         handlers.Metadata
+	invocation *Invocation
+}
+
+var (
+	asyncMu        sync.RWMutex
+	asyncTasks     chan *asyncTask
+	asyncResponder Responder
+	asyncWg        sync.WaitGroup
+)
+
+// StartAsync starts the workers running the asynchronous invocations submitted with Submit.
+// The result of every invocation is reported using the responder.
+//
+// Parameters:
+//   - workers: The number of workers, DefaultAsyncWorkers if not positive.
+//   - queueSize: The number of invocations waiting for a worker, DefaultAsyncQueueSize if not positive.
+//   - responder: The responder reporting the results, usually a service.OrcaloopClient.
+//
+// Returns:
+//
+//	ErrAsyncUnavailable if the responder is nil, otherwise nil.
+func StartAsync(workers, queueSize int, responder Responder) error {
+	if responder == nil {
+		return ErrAsyncUnavailable
+	}
+	if workers <= 0 {
+		workers = DefaultAsyncWorkers
+	}
+	if queueSize <= 0 {
+		queueSize = DefaultAsyncQueueSize
+	}
+	asyncMu.Lock()
+	defer asyncMu.Unlock()
+	if asyncTasks != nil {
+		return nil
+	}
+	asyncTasks = make(chan *asyncTask, queueSize)
+	asyncResponder = responder
+	for i := 0; i < workers; i++ {
+		asyncWg.Add(1)
+		go runAsync(asyncTasks, responder)
+	}
+	return nil
+}
+
+// StopAsync stops accepting asynchronous invocations and waits for the queued and running ones to complete.
+//
+// Parameters:
+//   - ctx: The context bounding the wait.
+//
+// Returns:
+//
+//	The error of the context if it is done before the workers stopped.
+func StopAsync(ctx context.Context) error {
+	asyncMu.Lock()
+	if asyncTasks != nil {
+		close(asyncTasks)
+		asyncTasks = nil
+		asyncResponder = nil
+	}
+	asyncMu.Unlock()
+	stopped := make(chan struct{})
+	go func() {
+		asyncWg.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Submit queues the invocation of the handler to be run by a worker. It does not wait for the
+// invocation to start. The handler is invoked with a context derived by Context from a context
+// carrying the metadata of ctx, as the invocation outlives the request submitting it.
+// Once the handler returns, its error is set as the ErrorKey of the pipeline and the pipeline is
+// reported using the Responder.
+//
+// Parameters:
+//   - ctx: The context of the request submitting the invocation.
+//   - actionId: The id of the action.
+//   - handler: The handler of the action.
+//   - pipeline: The pipeline passed to the handler.
+//
+// Returns:
+//
+//	ErrAsyncUnavailable if StartAsync was not called, ErrDraining if the service is draining,
+//	ErrAsyncQueueFull if no more invocations can be queued, otherwise nil.
+func Submit(ctx context.Context, actionId string, handler handlers.ActionHandler, pipeline *data.Pipeline) error {
+	if Draining() {
+		return ErrDraining
+	}
+	asyncMu.RLock()
+	defer asyncMu.RUnlock()
+	if asyncTasks == nil {
+		return ErrAsyncUnavailable
+	}
+	task := &asyncTask{
+		actionId: actionId,
+		handler:  handler,
+		pipeline: pipeline,
+		md:       handlers.MetadataFromContext(ctx),
+	}
+	responder := asyncResponder
+	task.invocation = Track(actionId, pipeline, func(err error) {
+		respond(responder, task, err)
+	})
+	select {
+	case asyncTasks <- task:
+		return nil
+	default:
+		task.invocation.Finish(nil)
+		return ErrAsyncQueueFull
+	}
+}
+
+// runAsync runs the queued invocations until the queue is closed.
+func runAsync(tasks <-chan *asyncTask, responder Responder) {
+	defer asyncWg.Done()
+	for task := range tasks {
+		runTask(task, responder)
+	}
+}
+
+// runTask invokes the handler of the task and reports its result.
+// If the responder is a ProgressSender, the handler can report its progress and heartbeats are sent while it runs.
+func runTask(task *asyncTask, responder Responder) {
+	if task.invocation.Aborted() {
+		return
+	}
+	spec := task.handler.Spec()
+	ctx, cancel := Context(handlers.WithMetadata(context.Background(), task.md), spec)
+	defer cancel()
+	// the task was accepted before the service started draining, it still runs while draining
+	release, err := exec.acquire(ctx, task.actionId, true)
+	if err == nil {
+		stopHeartbeats := func() {}
+		if sender, ok := responder.(ProgressSender); ok {
+			reporter := newProgressReporter(ctx, sender, task.actionId, task.pipeline)
+			ctx = handlers.WithProgressReporter(ctx, reporter)
+			stopHeartbeats = reporter.startHeartbeats()
+		}
+		err = Invoke(ctx, task.actionId, task.handler, task.pipeline)
+		stopHeartbeats()
+		release()
+	}
+	if context.Cause(ctx) == ErrShutdown {
+		err = ErrShutdown
+	}
+	// the invocation may have been aborted and reported while the handler was running
+	task.invocation.Finish(func() {
+		respond(responder, task, err)
+	})
+}
+
+// respond reports the result of the task, or its failure with the error.
+func respond(responder Responder, task *asyncTask, err error) {
+	if err != nil && !task.pipeline.Has(data.ErrorKey) {
+		task.pipeline.Set(data.ErrorKey, errorMessage(err))
+	}
+	if err = responder.Respond(*task.handler.Spec(), task.pipeline); err != nil {
+		logger.ErrorF("Failed to report the result of action %s for instance %s: %v", task.actionId, task.pipeline.Id(), err)
+	}
+}
@@ -0,0 +1,88 @@
+// Package dispatch holds the state shared by the entry points of the action service,
+// the REST api and the messaging listeners, to invoke the registered action handlers.
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+// ErrShutdown is the cause of the cancellation of the contexts of invocations running when the service is stopped.
+var ErrShutdown = errors.New("action service is shutting down")
+
+var (
+	mu         sync.RWMutex
+	baseCtx    context.Context
+	cancelBase context.CancelCauseFunc
+)
+
+func init() {
+	baseCtx, cancelBase = context.WithCancelCause(context.Background())
+}
+
+// Open enables the dispatching of invocations after a Shutdown or a drain. It is called when the service starts.
+func Open() {
+	resetDrain()
+	mu.Lock()
+	defer mu.Unlock()
+	if baseCtx.Err() != nil {
+		baseCtx, cancelBase = context.WithCancelCause(context.Background())
+	}
+}
+
+// Shutdown cancels the contexts of all the running invocations with ErrShutdown.
+// Contexts created afterwards are cancelled immediately until Open is called.
+func Shutdown() {
+	mu.RLock()
+	defer mu.RUnlock()
+	cancelBase(ErrShutdown)
+}
+
+// Context derives the context of an invocation of the action from the parent.
+// The context is cancelled when the parent is done, when the service shuts down and,
+// if the action declares a Qos.Timeout on its endpoint, when the timeout expires.
+// The returned cancel function must be called once the invocation is complete.
+//
+// Parameters:
+//   - parent: The context of the request or the listener receiving the invocation.
+//   - spec: The spec of the invoked action.
+//
+// Returns:
+//   - ctx: The context of the invocation.
+//   - cancel: The function releasing the resources of the context.
+func Context(parent context.Context, spec *models.ActionSpec) (ctx context.Context, cancel context.CancelFunc) {
+	mu.RLock()
+	base := baseCtx
+	mu.RUnlock()
+	var cancelCause context.CancelCauseFunc
+	ctx, cancelCause = context.WithCancelCause(parent)
+	stop := context.AfterFunc(base, func() {
+		cancelCause(context.Cause(base))
+	})
+	cancel = func() {
+		stop()
+		cancelCause(context.Canceled)
+	}
+	if timeout := Timeout(spec); timeout > 0 {
+		var cancelTimeout context.CancelFunc
+		ctx, cancelTimeout = context.WithTimeout(ctx, timeout)
+		cancelParent := cancel
+		cancel = func() {
+			cancelTimeout()
+			cancelParent()
+		}
+	}
+	return
+}
+
+// Timeout returns the Qos.Timeout of the endpoint of the action as a duration, zero if it has none.
+func Timeout(spec *models.ActionSpec) time.Duration {
+	if spec == nil || spec.Endpoint == nil || spec.Endpoint.Qos == nil {
+		return 0
+	}
+	return time.Duration(spec.Endpoint.Qos.Timeout) * time.Millisecond
+}
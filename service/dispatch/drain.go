@@ -0,0 +1,151 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+)
+
+var ErrDraining = errors.New("action service is draining")
+
+var draining atomic.Bool
+
+var (
+	invocationsMu sync.Mutex
+	invocations   = make(map[*Invocation]struct{})
+)
+
+// Invocation is an invocation of an action whose outcome must be reported to the Orcaloop server,
+// tracked so that it can be reported as failed if it is still running when the service stops.
+type Invocation struct {
+	actionId string
+	pipeline *data.Pipeline
+	report   func(err error)
+	done     atomic.Bool
+}
+
+// Track registers an invocation of the action until Finish is called.
+// If the invocation is aborted by Abort, report is invoked with the error of the abort.
+//
+// Parameters:
+//   - actionId: The id of the action.
+//   - pipeline: The pipeline of the invocation.
+//   - report: The function reporting the failure of the invocation.
+//
+// Returns:
+//   - *Invocation: The tracked invocation.
+func Track(actionId string, pipeline *data.Pipeline, report func(err error)) *Invocation {
+	inv := &Invocation{
+		actionId: actionId,
+		pipeline: pipeline,
+		report:   report,
+	}
+	invocationsMu.Lock()
+	invocations[inv] = struct{}{}
+	invocationsMu.Unlock()
+	return inv
+}
+
+// Finish invokes complete, if not nil, and ends the tracking of the invocation once it returns,
+// so that Drain waits for the outcome of the invocation to be reported. Finish returns false
+// without invoking complete if the invocation was aborted, its failure has then already been reported.
+func (inv *Invocation) Finish(complete func()) bool {
+	if !inv.done.CompareAndSwap(false, true) {
+		return false
+	}
+	defer untrack(inv)
+	if complete != nil {
+		complete()
+	}
+	return true
+}
+
+// Aborted checks if the invocation was aborted.
+func (inv *Invocation) Aborted() bool {
+	return inv.done.Load()
+}
+
+// untrack removes the invocation and wakes up Drain.
+func untrack(inv *Invocation) {
+	invocationsMu.Lock()
+	delete(invocations, inv)
+	invocationsMu.Unlock()
+	exec.mu.Lock()
+	exec.signal()
+	exec.mu.Unlock()
+}
+
+// BeginDrain stops accepting new invocations: Acquire and Submit fail with ErrDraining.
+// The invocations that are running or queued are not affected.
+func BeginDrain() {
+	draining.Store(true)
+}
+
+// Draining checks if the service is draining.
+func Draining() bool {
+	return draining.Load()
+}
+
+// Drain waits until the invocations holding a slot of the executor and the tracked invocations are complete.
+//
+// Parameters:
+//   - ctx: The context bounding the wait, usually the grace period of the shutdown.
+//
+// Returns:
+//
+//	The error of the context if it is done before all the invocations are complete.
+func Drain(ctx context.Context) error {
+	for {
+		exec.mu.Lock()
+		idle := exec.inFlight == 0 && exec.queued == 0
+		changed := exec.changed
+		exec.mu.Unlock()
+		invocationsMu.Lock()
+		idle = idle && len(invocations) == 0
+		invocationsMu.Unlock()
+		if idle {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Abort reports the tracked invocations that are still running or queued as failed with the error.
+//
+// Parameters:
+//   - err: The error reported for the invocations.
+//
+// Returns:
+//   - int: The number of aborted invocations.
+func Abort(err error) (aborted int) {
+	invocationsMu.Lock()
+	pending := make([]*Invocation, 0, len(invocations))
+	for inv := range invocations {
+		pending = append(pending, inv)
+	}
+	invocationsMu.Unlock()
+	for _, inv := range pending {
+		if !inv.done.CompareAndSwap(false, true) {
+			continue
+		}
+		logger.ErrorF("Aborting action %s for instance %s: %v", inv.actionId, inv.pipeline.Id(), err)
+		if inv.report != nil {
+			inv.report(err)
+		}
+		untrack(inv)
+		aborted++
+	}
+	return
+}
+
+// resetDrain accepts invocations again, it is called when the service starts.
+func resetDrain() {
+	draining.Store(false)
+}
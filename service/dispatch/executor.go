@@ -0,0 +1,190 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrExecutorFull = errors.New("action service is at capacity")
+
+// Gauges is a point in time view of the work of the executor.
+type Gauges struct {
+	// InFlight is the number of handlers running
+	InFlight int `json:"in_flight"`
+	// Queued is the number of invocations waiting for a slot
+	Queued int `json:"queued"`
+	// Actions holds the gauges of every action with running or waiting invocations
+	Actions map[string]ActionGauges `json:"actions,omitempty"`
+}
+
+// ActionGauges is a point in time view of the work of an action.
+type ActionGauges struct {
+	InFlight int `json:"in_flight"`
+	Queued   int `json:"queued"`
+}
+
+// executor limits the number of handlers running concurrently.
+type executor struct {
+	mu           sync.Mutex
+	maxInFlight  int
+	queueDepth   int
+	actionLimits map[string]int
+	inFlight     int
+	queued       int
+	actions      map[string]*ActionGauges
+	// changed is closed and replaced whenever a slot is released to wake up the waiting invocations
+	changed chan struct{}
+}
+
+var exec = &executor{
+	actions: make(map[string]*ActionGauges),
+	changed: make(chan struct{}),
+}
+
+// ConfigureExecutor sets the limits of the executor. A limit that is not positive means no limit.
+// Invocations running or waiting when the limits change are not affected.
+//
+// Parameters:
+//   - maxInFlight: The number of handlers running concurrently across all the actions.
+//   - queueDepth: The number of invocations waiting for a slot before Acquire fails with ErrExecutorFull,
+//     not limited if not positive.
+//     Invocations that block are not limited by the queue depth.
+//   - actionLimits: The number of handlers running concurrently per action id.
+func ConfigureExecutor(maxInFlight, queueDepth int, actionLimits map[string]int) {
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	exec.maxInFlight = maxInFlight
+	exec.queueDepth = queueDepth
+	exec.actionLimits = make(map[string]int, len(actionLimits))
+	for k, v := range actionLimits {
+		exec.actionLimits[k] = v
+	}
+	exec.signal()
+}
+
+// Acquire reserves a slot of the executor to run a handler of the action.
+// If no slot is available the invocation waits in the queue. Unless block is set, it fails
+// with ErrExecutorFull if the queue is already full; blocking callers such as the messaging
+// listeners wait until a slot is available, which stops them from consuming further messages.
+// The returned release function must be called once the handler returns.
+//
+// Parameters:
+//   - ctx: The context bounding the wait for a slot.
+//   - actionId: The id of the action.
+//   - block: Whether to wait regardless of the queue depth.
+//
+// Returns:
+//   - release: The function releasing the slot.
+//   - err: ErrExecutorFull if the queue is full, ErrDraining if the service is draining,
+//     the error of the context if it is done before a slot is available.
+func Acquire(ctx context.Context, actionId string, block bool) (release func(), err error) {
+	if Draining() {
+		return nil, ErrDraining
+	}
+	return exec.acquire(ctx, actionId, block)
+}
+
+// ExecutorGauges returns the gauges of the in-flight and queued work of the executor.
+func ExecutorGauges() Gauges {
+	exec.mu.Lock()
+	defer exec.mu.Unlock()
+	gauges := Gauges{
+		InFlight: exec.inFlight,
+		Queued:   exec.queued,
+		Actions:  make(map[string]ActionGauges, len(exec.actions)),
+	}
+	for id, g := range exec.actions {
+		gauges.Actions[id] = *g
+	}
+	return gauges
+}
+
+func (e *executor) acquire(ctx context.Context, actionId string, block bool) (release func(), err error) {
+	queued := false
+	for {
+		e.mu.Lock()
+		g := e.action(actionId)
+		if e.available(actionId, g) {
+			if queued {
+				e.queued--
+				g.Queued--
+			}
+			e.inFlight++
+			g.InFlight++
+			e.mu.Unlock()
+			var once sync.Once
+			release = func() {
+				once.Do(func() { e.release(actionId) })
+			}
+			return
+		}
+		if !queued {
+			if !block && e.queueDepth > 0 && e.queued >= e.queueDepth {
+				e.cleanup(actionId, g)
+				e.mu.Unlock()
+				err = ErrExecutorFull
+				return
+			}
+			queued = true
+			e.queued++
+			g.Queued++
+		}
+		changed := e.changed
+		e.mu.Unlock()
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			e.mu.Lock()
+			e.queued--
+			g.Queued--
+			e.cleanup(actionId, g)
+			e.mu.Unlock()
+			err = ctx.Err()
+			return
+		}
+	}
+}
+
+// available checks if a handler of the action can run. Callers must hold the lock.
+func (e *executor) available(actionId string, g *ActionGauges) bool {
+	if e.maxInFlight > 0 && e.inFlight >= e.maxInFlight {
+		return false
+	}
+	limit := e.actionLimits[actionId]
+	return limit <= 0 || g.InFlight < limit
+}
+
+// action returns the gauges of the action. Callers must hold the lock.
+func (e *executor) action(actionId string) *ActionGauges {
+	g, ok := e.actions[actionId]
+	if !ok {
+		g = &ActionGauges{}
+		e.actions[actionId] = g
+	}
+	return g
+}
+
+// cleanup removes the gauges of an idle action. Callers must hold the lock.
+func (e *executor) cleanup(actionId string, g *ActionGauges) {
+	if g.InFlight == 0 && g.Queued == 0 {
+		delete(e.actions, actionId)
+	}
+}
+
+// release frees the slot held by a handler of the action and wakes up the waiting invocations.
+func (e *executor) release(actionId string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	g := e.action(actionId)
+	e.inFlight--
+	g.InFlight--
+	e.cleanup(actionId, g)
+	e.signal()
+}
+
+// signal wakes up the waiting invocations. Callers must hold the lock.
+func (e *executor) signal() {
+	close(e.changed)
+	e.changed = make(chan struct{})
+}
@@ -0,0 +1,79 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestAcquireLimits(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxInFlight  int
+		queueDepth   int
+		actionLimits map[string]int
+		held         []string
+		actionId     string
+		wantErr      error
+	}{
+		{name: "no limits", held: []string{"a", "a"}, actionId: "a"},
+		{name: "below max in flight", maxInFlight: 2, held: []string{"a"}, actionId: "b"},
+		{name: "max in flight without queue depth waits", maxInFlight: 1, held: []string{"a"}, actionId: "b", wantErr: context.DeadlineExceeded},
+		{name: "negative queue depth waits", maxInFlight: 1, queueDepth: -1, held: []string{"a"}, actionId: "b", wantErr: context.DeadlineExceeded},
+		{name: "action limit", actionLimits: map[string]int{"a": 1}, held: []string{"a"}, actionId: "a", wantErr: context.DeadlineExceeded},
+		{name: "other action not limited", actionLimits: map[string]int{"a": 1}, held: []string{"a"}, actionId: "b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ConfigureExecutor(tt.maxInFlight, tt.queueDepth, tt.actionLimits)
+			defer ConfigureExecutor(0, 0, nil)
+			for _, id := range tt.held {
+				release, err := Acquire(context.Background(), id, false)
+				if err != nil {
+					t.Fatalf("Acquire(%s) error = %v", id, err)
+				}
+				defer release()
+			}
+			ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+			defer cancel()
+			release, err := Acquire(ctx, tt.actionId, false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Acquire(%s) error = %v, want %v", tt.actionId, err, tt.wantErr)
+			}
+			if err == nil {
+				release()
+			}
+		})
+	}
+}
+
+func TestAcquireQueueDepth(t *testing.T) {
+	ConfigureExecutor(1, 1, nil)
+	defer ConfigureExecutor(0, 0, nil)
+	release, err := Acquire(context.Background(), "a", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waiting := make(chan error)
+	go func() {
+		r, err := Acquire(context.Background(), "a", false)
+		if err == nil {
+			r()
+		}
+		waiting <- err
+	}()
+	for ExecutorGauges().Queued != 1 {
+		time.Sleep(time.Millisecond)
+	}
+	if _, err = Acquire(context.Background(), "a", false); !errors.Is(err, ErrExecutorFull) {
+		t.Fatalf("Acquire() error = %v, want %v", err, ErrExecutorFull)
+	}
+	release()
+	if err = <-waiting; err != nil {
+		t.Fatalf("queued Acquire() error = %v", err)
+	}
+	if g := ExecutorGauges(); g.InFlight != 0 || g.Queued != 0 || len(g.Actions) != 0 {
+		t.Fatalf("ExecutorGauges() = %+v, want idle", g)
+	}
+}
@@ -0,0 +1,166 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+
+	"oss.nandlabs.io/golly/l3"
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/events"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+	"oss.nandlabs.io/orcaloop-sdk/utils"
+)
+
+// DefaultQuarantineThreshold is the default number of panics after which an action is quarantined.
+const DefaultQuarantineThreshold = 5
+
+var logger = l3.Get()
+
+// QuarantinedError is the error returned when an action is invoked while it is quarantined.
+type QuarantinedError struct {
+	ActionId string
+	Panics   int
+}
+
+// Error implements the error interface.
+func (e *QuarantinedError) Error() string {
+	return fmt.Sprintf("action %s is quarantined after %d panics", e.ActionId, e.Panics)
+}
+
+var (
+	panicsMu            sync.Mutex
+	panics              = make(map[string]int)
+	quarantineThreshold = DefaultQuarantineThreshold
+)
+
+// SetQuarantineThreshold sets the number of panics after which an action is quarantined.
+// Zero restores DefaultQuarantineThreshold and a negative value disables the quarantine.
+func SetQuarantineThreshold(threshold int) {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	if threshold == 0 {
+		threshold = DefaultQuarantineThreshold
+	}
+	quarantineThreshold = threshold
+}
+
+// Panics returns the number of panics recorded for the action.
+func Panics(actionId string) int {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	return panics[actionId]
+}
+
+// IsQuarantined checks if the action is quarantined. Quarantined actions are not invoked until Reinstate is called.
+func IsQuarantined(actionId string) bool {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	return quarantineThreshold > 0 && panics[actionId] >= quarantineThreshold
+}
+
+// Reinstate clears the panics recorded for the action, lifting its quarantine.
+func Reinstate(actionId string) {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	delete(panics, actionId)
+}
+
+// recordPanic records a panic of the action and reports whether it is now quarantined.
+func recordPanic(actionId string) (quarantined bool) {
+	panicsMu.Lock()
+	defer panicsMu.Unlock()
+	panics[actionId]++
+	return quarantineThreshold > 0 && panics[actionId] == quarantineThreshold
+}
+
+// Invoke invokes the handler of the action with the context, see handlers.Invoke.
+// A panic of the handler is recovered and returned as a *handlers.PanicError, the panics are
+// counted per action and the action is quarantined once the count reaches the quarantine threshold.
+// A *QuarantinedError is returned without invoking the handler if the action is quarantined.
+//
+// Parameters:
+//   - ctx: The context of the invocation, see Context.
+//   - actionId: The id of the action.
+//   - handler: The handler of the action.
+//   - pipeline: The pipeline passed to the handler.
+//
+// Returns:
+//
+//	The error returned by the handler, a *handlers.PanicError or a *QuarantinedError.
+func Invoke(ctx context.Context, actionId string, handler handlers.ActionHandler, pipeline *data.Pipeline) (err error) {
+	if IsQuarantined(actionId) {
+		return &QuarantinedError{ActionId: actionId, Panics: Panics(actionId)}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			err = &handlers.PanicError{
+				ActionId: actionId,
+				Value:    r,
+				Stack:    debug.Stack(),
+			}
+		}
+		var panicErr *handlers.PanicError
+		if errors.As(err, &panicErr) {
+			logger.ErrorF("Action %s panicked: %v\n%s", actionId, panicErr.Value, panicErr.Stack)
+			if recordPanic(actionId) {
+				logger.ErrorF("Action %s is quarantined after %d panics", actionId, Panics(actionId))
+			}
+		}
+	}()
+	return handlers.Invoke(ctx, handler, pipeline)
+}
+
+// FailureEvent creates the StatusFailed event reporting the error of an invocation.
+// The Error of the event carries ErrCodeActionPanic and the stack trace for a *handlers.PanicError,
+// ErrCodeActionQuarantined for a *QuarantinedError and defaultCode otherwise. The message of the
+// error, followed by the stack trace for panics, is set as the ErrorKey of the data of the event.
+//
+// Parameters:
+//   - pipeline: The pipeline of the invocation holding the instance and step ids.
+//   - err: The error of the invocation.
+//   - defaultCode: The code of errors other than panics and quarantines.
+//
+// Returns:
+//   - *events.StepChangeEvent: The event reporting the failure.
+func FailureEvent(pipeline *data.Pipeline, err error, defaultCode string) *events.StepChangeEvent {
+	modelErr := &models.Error{
+		Code:    defaultCode,
+		Message: err.Error(),
+	}
+	var panicErr *handlers.PanicError
+	var quarantinedErr *QuarantinedError
+	switch {
+	case errors.As(err, &panicErr):
+		modelErr.Code = models.ErrCodeActionPanic
+		modelErr.Details = string(panicErr.Stack)
+	case errors.As(err, &quarantinedErr):
+		modelErr.Code = models.ErrCodeActionQuarantined
+	}
+	eventData := map[string]any{
+		data.ErrorKey: errorMessage(err),
+	}
+	if pipeline.Has(data.WorkflowIdKey) {
+		eventData[data.WorkflowIdKey] = pipeline.GetWorkflowId()
+	}
+	return &events.StepChangeEvent{
+		EventId:    utils.GenerateId(),
+		InstanceId: pipeline.Id(),
+		StepId:     pipeline.GetStepId(),
+		Status:     models.StatusFailed,
+		Data:       eventData,
+		Error:      modelErr,
+	}
+}
+
+// errorMessage returns the message of the error followed by the stack trace for a *handlers.PanicError.
+func errorMessage(err error) string {
+	var panicErr *handlers.PanicError
+	if errors.As(err, &panicErr) {
+		return err.Error() + "\n" + string(panicErr.Stack)
+	}
+	return err.Error()
+}
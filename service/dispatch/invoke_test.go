@@ -0,0 +1,111 @@
+package dispatch
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+func TestFailureEvent(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode string
+	}{
+		{name: "error", err: errors.New("failed"), wantCode: models.ErrCodeActionFailed},
+		{name: "panic", err: &handlers.PanicError{ActionId: "a", Value: "boom", Stack: []byte("stack")}, wantCode: models.ErrCodeActionPanic},
+		{name: "quarantined", err: &QuarantinedError{ActionId: "a", Panics: 3}, wantCode: models.ErrCodeActionQuarantined},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			pipeline := data.NewPipeline("instance")
+			pipeline.Set(data.StepIdKey, "step")
+			event := FailureEvent(pipeline, tt.err, models.ErrCodeActionFailed)
+			if event.Status != models.StatusFailed || event.Error == nil || event.Error.Code != tt.wantCode {
+				t.Fatalf("FailureEvent() = %+v, want a failure with code %s", event, tt.wantCode)
+			}
+			if event.Data[data.ErrorKey] == nil {
+				t.Fatal("FailureEvent() did not set the error of the data")
+			}
+		})
+	}
+}
+
+func TestInvokeRecoversPanics(t *testing.T) {
+	SetQuarantineThreshold(0)
+	defer Reinstate("panicking")
+	handler := handlers.NewHandler(&models.ActionSpec{Id: "panicking"}, func(ctx context.Context, p *data.Pipeline) error {
+		panic("boom")
+	})
+	pipeline := data.NewPipeline("instance")
+	err := Invoke(context.Background(), "panicking", handler, pipeline)
+	var panicErr *handlers.PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || panicErr.ActionId != "panicking" || len(panicErr.Stack) == 0 {
+		t.Fatalf("Invoke() error = %#v, want a *handlers.PanicError with the stack", err)
+	}
+	event := FailureEvent(pipeline, err, models.ErrCodeActionFailed)
+	message, _ := event.Data[data.ErrorKey].(string)
+	if !strings.HasPrefix(message, err.Error()+"\n") || !strings.Contains(message, string(panicErr.Stack)) {
+		t.Fatalf("error of the event = %q, want the message followed by the stack", message)
+	}
+	if event.Error.Details != string(panicErr.Stack) {
+		t.Fatal("the details of the error do not hold the stack")
+	}
+}
+
+func TestQuarantine(t *testing.T) {
+	SetQuarantineThreshold(2)
+	defer SetQuarantineThreshold(0)
+	defer Reinstate("flaky")
+	calls := 0
+	shouldPanic := true
+	handler := handlers.NewHandler(&models.ActionSpec{Id: "flaky"}, func(ctx context.Context, p *data.Pipeline) error {
+		calls++
+		if shouldPanic {
+			panic("boom")
+		}
+		return errors.New("failed")
+	})
+	invoke := func() error {
+		return Invoke(context.Background(), "flaky", handler, data.NewPipeline("instance"))
+	}
+
+	invoke()
+	if IsQuarantined("flaky") || Panics("flaky") != 1 {
+		t.Fatalf("after 1 panic: quarantined = %v, panics = %d", IsQuarantined("flaky"), Panics("flaky"))
+	}
+	// errors returned by the handler are not counted
+	shouldPanic = false
+	invoke()
+	shouldPanic = true
+	invoke()
+	if !IsQuarantined("flaky") || Panics("flaky") != 2 {
+		t.Fatalf("after 2 panics: quarantined = %v, panics = %d", IsQuarantined("flaky"), Panics("flaky"))
+	}
+	var quarantinedErr *QuarantinedError
+	if err := invoke(); !errors.As(err, &quarantinedErr) || quarantinedErr.Panics != 2 || calls != 3 {
+		t.Fatalf("Invoke() of a quarantined action = %v after %d calls, want a *QuarantinedError without calling the handler", err, calls)
+	}
+	if IsQuarantined("other") {
+		t.Fatal("the quarantine affects other actions")
+	}
+
+	SetQuarantineThreshold(-1)
+	if IsQuarantined("flaky") {
+		t.Fatal("a negative threshold does not disable the quarantine")
+	}
+	SetQuarantineThreshold(2)
+	Reinstate("flaky")
+	if IsQuarantined("flaky") || Panics("flaky") != 0 {
+		t.Fatal("Reinstate() did not lift the quarantine")
+	}
+	shouldPanic = false
+	if err := invoke(); err == nil || err.Error() != "failed" || calls != 4 {
+		t.Fatalf("Invoke() after Reinstate() = %v after %d calls, want the handler invoked", err, calls)
+	}
+}
@@ -0,0 +1,122 @@
+package dispatch
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/events"
+	"oss.nandlabs.io/orcaloop-sdk/utils"
+)
+
+// DefaultHeartbeatInterval is the default interval of the heartbeats sent while an asynchronous handler runs.
+const DefaultHeartbeatInterval = 30 * time.Second
+
+// ProgressSender sends the progress events of the invocations of an action to the Orcaloop server.
+// It is implemented by service.OrcaloopClient. The Responder of the asynchronous invocations
+// reports their progress if it implements ProgressSender.
+type ProgressSender interface {
+	SendProgress(ctx context.Context, actionId string, event *events.ProgressEvent) error
+}
+
+var (
+	heartbeatMu       sync.RWMutex
+	heartbeatInterval = DefaultHeartbeatInterval
+)
+
+// SetHeartbeatInterval sets the interval of the heartbeats of asynchronous handlers.
+// Zero restores DefaultHeartbeatInterval and a negative value disables the heartbeats.
+func SetHeartbeatInterval(interval time.Duration) {
+	heartbeatMu.Lock()
+	defer heartbeatMu.Unlock()
+	if interval == 0 {
+		interval = DefaultHeartbeatInterval
+	}
+	heartbeatInterval = interval
+}
+
+// progressReporter is the handlers.ProgressReporter of an asynchronous invocation.
+// It remembers the last reported progress, which is repeated by the heartbeats.
+type progressReporter struct {
+	mu       sync.Mutex
+	ctx      context.Context
+	sender   ProgressSender
+	actionId string
+	pipeline *data.Pipeline
+	percent  float64
+	message  string
+}
+
+// newProgressReporter creates the reporter of the invocation of the action.
+func newProgressReporter(ctx context.Context, sender ProgressSender, actionId string, pipeline *data.Pipeline) *progressReporter {
+	return &progressReporter{
+		ctx:      ctx,
+		sender:   sender,
+		actionId: actionId,
+		pipeline: pipeline,
+		percent:  -1,
+	}
+}
+
+// Progress sends a progress event with the partial output.
+func (r *progressReporter) Progress(percent float64, message string, partial map[string]any) error {
+	r.mu.Lock()
+	r.percent, r.message = percent, message
+	r.mu.Unlock()
+	return r.send(events.ProgressTypeProgress, percent, message, partial)
+}
+
+// heartbeat sends a heartbeat event with the last reported progress.
+func (r *progressReporter) heartbeat() {
+	r.mu.Lock()
+	percent, message := r.percent, r.message
+	r.mu.Unlock()
+	if err := r.send(events.ProgressTypeHeartbeat, percent, message, nil); err != nil {
+		logger.WarnF("Failed to send the heartbeat of action %s for instance %s: %v", r.actionId, r.pipeline.Id(), err)
+	}
+}
+
+// send sends a progress event of the given type.
+func (r *progressReporter) send(eventType string, percent float64, message string, partial map[string]any) error {
+	event := &events.ProgressEvent{
+		EventId:    utils.GenerateId(),
+		InstanceId: r.pipeline.Id(),
+		StepId:     r.pipeline.GetStepId(),
+		Type:       eventType,
+		Percent:    percent,
+		Message:    message,
+		Data:       partial,
+		Timestamp:  time.Now(),
+	}
+	return r.sender.SendProgress(r.ctx, r.actionId, event)
+}
+
+// startHeartbeats sends heartbeats at the heartbeat interval until the returned function is called.
+func (r *progressReporter) startHeartbeats() (stop func()) {
+	heartbeatMu.RLock()
+	interval := heartbeatInterval
+	heartbeatMu.RUnlock()
+	if interval < 0 {
+		return func() {}
+	}
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				r.heartbeat()
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
@@ -0,0 +1,95 @@
+package dispatch
+
+import (
+	"sort"
+	"sync"
+
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+)
+
+// Readiness describes whether the action service is ready to receive invocations.
+type Readiness struct {
+	// Ready is set once every action is acknowledged by the Orcaloop server and every listener is up
+	Ready bool `json:"ready"`
+	// Draining is set once the service started to stop
+	Draining bool `json:"draining,omitempty"`
+	// PendingActions are the ids of the actions not yet acknowledged by the Orcaloop server
+	PendingActions []string `json:"pending_actions,omitempty"`
+	// PendingListeners are the ids of the listeners that are not up
+	PendingListeners []string `json:"pending_listeners,omitempty"`
+}
+
+var (
+	readyMu         sync.Mutex
+	requireAck      bool
+	acknowledged    = make(map[string]struct{})
+	listenersStatus = make(map[string]bool)
+)
+
+// RequireAcknowledgement sets whether the actions of the ActionRegistry must be acknowledged by the
+// Orcaloop server, using Acknowledge, before the service is ready. It is not required by default,
+// as services started without a client do not register their actions.
+func RequireAcknowledgement(require bool) {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	requireAck = require
+}
+
+// Acknowledge records that the registration of the action was accepted by the Orcaloop server.
+//
+// Parameters:
+//   - actionId: The id of the action.
+func Acknowledge(actionId string) {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	acknowledged[actionId] = struct{}{}
+}
+
+// Acknowledged checks if the registration of the action was accepted by the Orcaloop server.
+func Acknowledged(actionId string) bool {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	_, ok := acknowledged[actionId]
+	return ok
+}
+
+// SetListener records whether the listener is up. Listeners are expected to be up from the first
+// call, the service is not ready until every known listener is up.
+//
+// Parameters:
+//   - id: The id of the listener.
+//   - up: Whether the listener is receiving messages.
+func SetListener(id string, up bool) {
+	readyMu.Lock()
+	defer readyMu.Unlock()
+	listenersStatus[id] = up
+}
+
+// CheckReadiness checks whether the service is ready to receive invocations.
+//
+// Returns:
+//   - Readiness: The readiness of the service and what it is waiting for.
+func CheckReadiness() Readiness {
+	readiness := Readiness{Draining: Draining()}
+	readyMu.Lock()
+	if requireAck {
+		for _, handler := range handlers.ActionRegistry.Items() {
+			if handler == nil || handler.Spec() == nil {
+				continue
+			}
+			if _, ok := acknowledged[handler.Spec().Id]; !ok {
+				readiness.PendingActions = append(readiness.PendingActions, handler.Spec().Id)
+			}
+		}
+	}
+	for id, up := range listenersStatus {
+		if !up {
+			readiness.PendingListeners = append(readiness.PendingListeners, id)
+		}
+	}
+	readyMu.Unlock()
+	sort.Strings(readiness.PendingActions)
+	sort.Strings(readiness.PendingListeners)
+	readiness.Ready = !readiness.Draining && len(readiness.PendingActions) == 0 && len(readiness.PendingListeners) == 0
+	return readiness
+}
@@ -0,0 +1,40 @@
+package dispatch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+func TestCheckReadiness(t *testing.T) {
+	Open()
+	defer RequireAcknowledgement(false)
+	handlers.ActionRegistry.Register("ready-action", handlers.NewHandler(&models.ActionSpec{Id: "ready-action"}, func(ctx context.Context, p *data.Pipeline) error {
+		return nil
+	}))
+	defer handlers.ActionRegistry.Unregister("ready-action")
+
+	if r := CheckReadiness(); !r.Ready {
+		t.Fatalf("CheckReadiness() = %+v, want ready without acknowledgement", r)
+	}
+	RequireAcknowledgement(true)
+	SetListener("ready-listener", false)
+	r := CheckReadiness()
+	if r.Ready || !reflect.DeepEqual(r.PendingActions, []string{"ready-action"}) || !reflect.DeepEqual(r.PendingListeners, []string{"ready-listener"}) {
+		t.Fatalf("CheckReadiness() = %+v, want the action and the listener pending", r)
+	}
+	Acknowledge("ready-action")
+	SetListener("ready-listener", true)
+	if r = CheckReadiness(); !r.Ready || !Acknowledged("ready-action") {
+		t.Fatalf("CheckReadiness() = %+v, want ready", r)
+	}
+	BeginDrain()
+	defer Open()
+	if r = CheckReadiness(); r.Ready || !r.Draining {
+		t.Fatalf("CheckReadiness() = %+v, want not ready while draining", r)
+	}
+}
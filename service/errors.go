@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+var (
+	ErrBadRequest   = errors.New("bad request")
+	ErrUnauthorized = errors.New("unauthorized")
+	ErrForbidden    = errors.New("forbidden")
+	ErrNotFound     = errors.New("not found")
+	ErrConflict     = errors.New("conflict")
+	ErrServer       = errors.New("orcaloop server error")
+)
+
+// APIError is the error returned for a non-2xx response of the Orcaloop server.
+// Use errors.As to access the status and the models.Error of the response, or errors.Is with
+// ErrBadRequest, ErrUnauthorized, ErrForbidden, ErrNotFound, ErrConflict or ErrServer to check its kind.
+type APIError struct {
+	// StatusCode is the HTTP status code of the response
+	StatusCode int
+	// Status is the HTTP status of the response, e.g. 404 Not Found
+	Status string
+	// Err is the error decoded from the body of the response, nil if the body is not a models.Error
+	Err *models.Error
+}
+
+// Error implements the error interface.
+func (e *APIError) Error() string {
+	if e.Err != nil && e.Err.Message != "" {
+		return fmt.Sprintf("orcaloop server responded with %s: %s (code %s)", e.Status, e.Err.Message, e.Err.Code)
+	}
+	return fmt.Sprintf("orcaloop server responded with %s", e.Status)
+}
+
+// Is matches the sentinel error of the status code of the response.
+func (e *APIError) Is(target error) bool {
+	switch e.StatusCode {
+	case http.StatusBadRequest, http.StatusUnprocessableEntity:
+		return target == ErrBadRequest
+	case http.StatusUnauthorized:
+		return target == ErrUnauthorized
+	case http.StatusForbidden:
+		return target == ErrForbidden
+	case http.StatusNotFound:
+		return target == ErrNotFound
+	case http.StatusConflict:
+		return target == ErrConflict
+	}
+	return e.StatusCode >= http.StatusInternalServerError && target == ErrServer
+}
+
+// apiError creates the APIError of the response, decoding its body into a models.Error if possible.
+func (r *response) apiError() error {
+	apiErr := &APIError{
+		StatusCode: r.statusCode,
+		Status:     r.status,
+	}
+	var modelErr models.Error
+	if len(r.body) > 0 && r.decode(&modelErr) == nil && (modelErr.Code != "" || modelErr.Message != "") {
+		apiErr.Err = &modelErr
+	}
+	return apiErr
+}
+
+// call sends the request and decodes the body of a 2xx response into out, if not nil.
+// Other responses are returned as an *APIError.
+func (oc *OrcaloopClient) call(ctx context.Context, method, path string, body, out any) (err error) {
+	var res *response
+	res, err = oc.execute(ctx, method, path, body)
+	if err != nil {
+		return
+	}
+	if res.statusCode < http.StatusOK || res.statusCode >= http.StatusMultipleChoices {
+		return res.apiError()
+	}
+	if out != nil && len(res.body) > 0 {
+		err = res.decode(out)
+	}
+	return
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+const (
+	InstancesEndpoint      = "/api/instances"
+	InstanceStatusEndpoint = "/api/instances/:instanceId"
+	InstanceCancelEndpoint = "/api/instances/:instanceId/cancel"
+	InstanceSignalEndpoint = "/api/instances/:instanceId/signals"
+)
+
+const (
+	// DefaultPollInterval is the default wait before the first poll of WaitForCompletion.
+	DefaultPollInterval = 500 * time.Millisecond
+	// DefaultMaxPollInterval is the default maximum wait between two polls of WaitForCompletion.
+	DefaultMaxPollInterval = 10 * time.Second
+)
+
+var ErrInstanceIdRequired = errors.New("instance id is required")
+
+// InstanceListOptions holds the filters and the pagination of a list of workflow instances.
+type InstanceListOptions struct {
+	// WorkflowId filters the instances by workflow, ignored if empty
+	WorkflowId string
+	// Status filters the instances by status, ignored if StatusUnknown
+	Status models.Status
+	// Page is the page to fetch, starting at 1, the server default is used if not positive
+	Page int
+	// PageSize is the maximum number of instances per page, the server default is used if not positive
+	PageSize int
+}
+
+// query encodes the options as query parameters.
+func (o *InstanceListOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.WorkflowId != "" {
+		q.Set("workflow_id", o.WorkflowId)
+	}
+	if o.Status != models.StatusUnknown {
+		q.Set("status", strconv.Itoa(int(o.Status)))
+	}
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	return q
+}
+
+// instancePath returns the path of the endpoint for the instance id.
+func instancePath(endpoint, instanceId string) string {
+	return strings.ReplaceAll(endpoint, ":instanceId", url.PathEscape(instanceId))
+}
+
+// StartInstance starts an instance of the workflow.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflowId: The id of the workflow.
+//   - version: The version of the workflow, zero starts the latest version.
+//   - pipelineData: The initial data of the pipeline of the instance.
+//
+// Returns:
+//   - instanceId: The id of the started instance.
+//   - err: An *APIError matching ErrNotFound if the workflow does not exist.
+func (oc *OrcaloopClient) StartInstance(ctx context.Context, workflowId string, version int, pipelineData map[string]any) (instanceId string, err error) {
+	if workflowId == "" {
+		return "", ErrWorkflowIdRequired
+	}
+	request := &models.StartInstanceRequest{
+		WorkflowId:      workflowId,
+		WorkflowVersion: version,
+		Data:            pipelineData,
+	}
+	instance := &models.WorkflowInstance{}
+	if err = oc.call(ctx, http.MethodPost, InstancesEndpoint, request, instance); err == nil {
+		instanceId = instance.Id
+	}
+	return
+}
+
+// GetInstance fetches the status of the instance and of its steps.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - instanceId: The id of the instance.
+//
+// Returns:
+//   - instance: The instance.
+//   - err: An *APIError matching ErrNotFound if the instance does not exist.
+func (oc *OrcaloopClient) GetInstance(ctx context.Context, instanceId string) (instance *models.WorkflowInstance, err error) {
+	if instanceId == "" {
+		return nil, ErrInstanceIdRequired
+	}
+	instance = &models.WorkflowInstance{}
+	if err = oc.call(ctx, http.MethodGet, instancePath(InstanceStatusEndpoint, instanceId), nil, instance); err != nil {
+		instance = nil
+	}
+	return
+}
+
+// ListInstances lists the workflow instances.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - opts: The filters and the page to fetch, nil lists the first page of all the instances.
+//
+// Returns:
+//   - list: The page of instances.
+//   - err: An *APIError if the request failed.
+func (oc *OrcaloopClient) ListInstances(ctx context.Context, opts *InstanceListOptions) (list *models.InstanceList, err error) {
+	list = &models.InstanceList{}
+	if err = oc.call(ctx, http.MethodGet, withQuery(InstancesEndpoint, opts.query()), nil, list); err != nil {
+		list = nil
+	}
+	return
+}
+
+// CancelInstance cancels a running instance.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - instanceId: The id of the instance.
+//
+// Returns:
+//
+//	An *APIError matching ErrNotFound if the instance does not exist or ErrConflict if it is already finished.
+func (oc *OrcaloopClient) CancelInstance(ctx context.Context, instanceId string) error {
+	if instanceId == "" {
+		return ErrInstanceIdRequired
+	}
+	return oc.call(ctx, http.MethodPost, instancePath(InstanceCancelEndpoint, instanceId), nil, nil)
+}
+
+// SignalInstance sends an external signal to an instance, e.g. to resume an instance waiting for an approval.
+// The data of the signal is merged into the pipeline of the instance.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - instanceId: The id of the instance.
+//   - name: The name of the signal.
+//   - signalData: The data of the signal.
+//
+// Returns:
+//
+//	An *APIError matching ErrNotFound if the instance does not exist or ErrConflict if it is not waiting for the signal.
+func (oc *OrcaloopClient) SignalInstance(ctx context.Context, instanceId, name string, signalData map[string]any) error {
+	if instanceId == "" {
+		return ErrInstanceIdRequired
+	}
+	signal := &models.Signal{
+		Name: name,
+		Data: signalData,
+	}
+	return oc.call(ctx, http.MethodPost, instancePath(InstanceSignalEndpoint, instanceId), signal, nil)
+}
+
+// WaitForCompletion polls the instance until its status is terminal, see models.Status.IsTerminal.
+// The wait between two polls starts at the poll interval of the client and doubles up to its maximum,
+// see WithPollInterval. Transient errors do not stop the wait.
+//
+// Parameters:
+//   - ctx: The context bounding the wait.
+//   - instanceId: The id of the instance.
+//
+// Returns:
+//   - instance: The instance in its terminal status.
+//   - err: The error of the context if it is done first, the error of a poll if it cannot be retried.
+func (oc *OrcaloopClient) WaitForCompletion(ctx context.Context, instanceId string) (instance *models.WorkflowInstance, err error) {
+	wait, maxWait := oc.pollInterval, oc.maxPollInterval
+	if wait <= 0 {
+		wait = DefaultPollInterval
+	}
+	if maxWait < wait {
+		maxWait = wait
+	}
+	for {
+		instance, err = oc.GetInstance(ctx, instanceId)
+		if err == nil && instance.Status.IsTerminal() {
+			return
+		}
+		if err != nil {
+			// connection errors, server errors and an open circuit breaker are polled again
+			var apiErr *APIError
+			if ctx.Err() != nil || (errors.As(err, &apiErr) && !errors.Is(err, ErrServer)) {
+				return nil, err
+			}
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		wait *= 2
+		if wait > maxWait {
+			wait = maxWait
+		}
+	}
+}
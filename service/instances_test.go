@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+func TestNonIdempotentRequestsKeepTheirKeyAcrossRetries(t *testing.T) {
+	var mu sync.Mutex
+	keys := make(map[string][]string)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts := append(keys[r.Method+" "+r.URL.Path], r.Header.Get(IdempotencyKeyHeader))
+		keys[r.Method+" "+r.URL.Path] = attempts
+		mu.Unlock()
+		if len(attempts) == 1 {
+			// the request was processed but the response was lost
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(models.WorkflowInstance{Id: "instance"})
+	}))
+	defer srv.Close()
+
+	oc := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{MaxRetries: 1, InitialBackoff: time.Millisecond}), WithCircuitBreaker(nil))
+	ctx := context.Background()
+	if _, err := oc.StartInstance(ctx, "workflow", 0, nil); err != nil {
+		t.Fatalf("StartInstance() error = %v", err)
+	}
+	if err := oc.SignalInstance(ctx, "instance", "approve", nil); err != nil {
+		t.Fatalf("SignalInstance() error = %v", err)
+	}
+	if _, err := oc.GetInstance(ctx, "instance"); err != nil {
+		t.Fatalf("GetInstance() error = %v", err)
+	}
+	for request, attempts := range keys {
+		if len(attempts) != 2 {
+			t.Fatalf("%s attempts = %d, want 2", request, len(attempts))
+		}
+		if request == "GET /api/instances/instance" {
+			if attempts[0] != "" {
+				t.Errorf("%s sent an idempotency key", request)
+			}
+			continue
+		}
+		if attempts[0] == "" || attempts[0] != attempts[1] {
+			t.Errorf("%s idempotency keys = %q, want the same key on every attempt", request, attempts)
+		}
+	}
+}
+
+func TestWithPollInterval(t *testing.T) {
+	tests := []struct {
+		name            string
+		interval, max   time.Duration
+		wantInterval    time.Duration
+		wantMaxInterval time.Duration
+	}{
+		{name: "zero", wantInterval: DefaultPollInterval, wantMaxInterval: DefaultMaxPollInterval},
+		{name: "negative", interval: -time.Second, max: -time.Second, wantInterval: DefaultPollInterval, wantMaxInterval: DefaultMaxPollInterval},
+		{name: "interval only", interval: time.Second, wantInterval: time.Second, wantMaxInterval: DefaultMaxPollInterval},
+		{name: "max below interval", interval: 20 * time.Second, max: time.Second, wantInterval: 20 * time.Second, wantMaxInterval: 20 * time.Second},
+		{name: "both", interval: time.Millisecond, max: time.Second, wantInterval: time.Millisecond, wantMaxInterval: time.Second},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			oc := NewClient("http://localhost", WithPollInterval(tt.interval, tt.max))
+			if oc.pollInterval != tt.wantInterval || oc.maxPollInterval != tt.wantMaxInterval {
+				t.Fatalf("poll intervals = %v, %v, want %v, %v", oc.pollInterval, oc.maxPollInterval, tt.wantInterval, tt.wantMaxInterval)
+			}
+		})
+	}
+}
+
+func TestWaitForCompletion(t *testing.T) {
+	var mu sync.Mutex
+	var polls []time.Time
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/instances/running" {
+			json.NewEncoder(w).Encode(models.WorkflowInstance{Id: "running", Status: models.StatusRunning})
+			return
+		}
+		mu.Lock()
+		polls = append(polls, time.Now())
+		n := len(polls)
+		mu.Unlock()
+		switch {
+		case n == 2:
+			// transient errors are polled again
+			w.WriteHeader(http.StatusInternalServerError)
+		case n < 4:
+			json.NewEncoder(w).Encode(models.WorkflowInstance{Id: "instance", Status: models.StatusRunning})
+		default:
+			json.NewEncoder(w).Encode(models.WorkflowInstance{Id: "instance", Status: models.StatusCompleted})
+		}
+	}))
+	defer srv.Close()
+
+	oc := NewClient(srv.URL, WithPollInterval(10*time.Millisecond, 20*time.Millisecond), WithRetries(0, 0))
+	instance, err := oc.WaitForCompletion(context.Background(), "instance")
+	if err != nil {
+		t.Fatalf("WaitForCompletion() error = %v", err)
+	}
+	if instance.Status != models.StatusCompleted || len(polls) != 4 {
+		t.Fatalf("WaitForCompletion() = %v after %d polls, want completed after 4", instance.Status, len(polls))
+	}
+	for i := 1; i < len(polls); i++ {
+		if gap := polls[i].Sub(polls[i-1]); gap < 10*time.Millisecond {
+			t.Fatalf("poll %d came %v after the previous one, want at least 10ms", i, gap)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	if _, err = oc.WaitForCompletion(ctx, "running"); err != context.DeadlineExceeded {
+		t.Fatalf("WaitForCompletion() error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -1,14 +1,20 @@
 package messaging
 
 import (
+	"context"
+	"errors"
 	"net/url"
+	"sync/atomic"
 
 	"oss.nandlabs.io/golly/l3"
 	"oss.nandlabs.io/golly/lifecycle"
 	"oss.nandlabs.io/golly/messaging"
 	"oss.nandlabs.io/orcaloop-sdk/data"
 	"oss.nandlabs.io/orcaloop-sdk/handlers"
+	"oss.nandlabs.io/orcaloop-sdk/models"
 	"oss.nandlabs.io/orcaloop-sdk/service"
+	"oss.nandlabs.io/orcaloop-sdk/service/dispatch"
+	"oss.nandlabs.io/orcaloop-sdk/utils"
 )
 
 var logger = l3.Get()
@@ -17,54 +23,159 @@ type MsgListener struct {
 	*lifecycle.SimpleComponent
 	// url is the url of the messaging endpoint
 	url *url.URL
+	// client reports the failures the handlers could not report
+	client *service.OrcaloopClient
+	// ctx is the context of the handlers invoked by the listener, cancelled when the listener stops
+	ctx    context.Context
+	cancel context.CancelFunc
+	// stopped is set once the listener stops, messages received afterwards are rejected
+	stopped atomic.Bool
 }
 
 // NewMsgListener creates a new MsgListener
 func NewMsgListener(url *url.URL, id string, client *service.OrcaloopClient) *MsgListener {
-	return &MsgListener{
-		SimpleComponent: &lifecycle.SimpleComponent{
-			CompId: id + "-msg-listener",
-			StartFunc: func() (err error) {
-				manager := messaging.GetManager()
+	listener := &MsgListener{
+		url:    url,
+		client: client,
+	}
+	compId := id + "-msg-listener"
+	// the service is not ready until the listener is up
+	dispatch.SetListener(compId, false)
+	listener.SimpleComponent = &lifecycle.SimpleComponent{
+		CompId: compId,
+		StartFunc: func() (err error) {
+			manager := messaging.GetManager()
+			listener.ctx, listener.cancel = context.WithCancel(context.Background())
+			listener.stopped.Store(false)
+			listenerCtx := listener.ctx
 
-				go func() {
-					//Create a named listener
-					options := messaging.NewOptionsBuilder().AddNamedListener(id).Build()
-					// Add the listener
-					err = manager.AddListener(url, func(msg messaging.Message) {
-						var actionId string
-						var actionHandler handlers.ActionHandler
+			go func() {
+				//Create a named listener
+				options := messaging.NewOptionsBuilder().AddNamedListener(id).Build()
+				// Add the listener
+				addErr := manager.AddListener(url, func(msg messaging.Message) {
+					listener.onMessage(listenerCtx, msg)
+				}, options...)
+				if addErr != nil {
+					logger.ErrorF("Failed to add the listener %s: %v", id, addErr)
+					return
+				}
+				dispatch.SetListener(compId, true)
+			}()
+			return
+		},
+		StopFunc: func() (err error) {
+			// The messaging manager does not support removing a listener, messages received
+			// from now on are rejected so that the broker redelivers them to another consumer
+			listener.stopped.Store(true)
+			dispatch.SetListener(compId, false)
+			if listener.cancel != nil {
+				listener.cancel()
+			}
+			return
+		},
+	}
+	return listener
+}
 
-						body := make(map[string]any)
-						err = msg.ReadJSON(&body)
-						if err != nil {
-							logger.ErrorF("Failed to decode message body: %v", err)
-							return
-						}
-						pipeline := data.NewPipelineFrom(body)
+// accept acknowledges the message once the outcome of its invocation is reported.
+func accept(msg messaging.Message) {
+	if err := msg.Rsvp(true); err != nil {
+		logger.ErrorF("Failed to acknowledge message: %v", err)
+	}
+}
 
-						actionId = pipeline.GetActionId()
-						actionHandler = handlers.ActionRegistry.Get(actionId)
-						if actionHandler == nil {
-							logger.ErrorF("Action not found: %v", err)
-							return
-						}
+// reject returns the message to the broker to be redelivered.
+func reject(msg messaging.Message) {
+	if err := msg.Rsvp(false); err != nil {
+		logger.ErrorF("Failed to reject message: %v", err)
+	}
+}
 
-						err = actionHandler.Handle(pipeline)
-						if err != nil {
-							logger.ErrorF("Failed to handle action: %v", err)
-							return
-						}
-					}, options...)
-				}()
-				return
-			},
-			StopFunc: func() (err error) {
-				//TODO: Implement stop function
-				// Remove the listener
-				return
-			},
-		},
-		url: url,
+// onMessage invokes the handler of the action of the message.
+func (l *MsgListener) onMessage(listenerCtx context.Context, msg messaging.Message) {
+	if l.stopped.Load() || dispatch.Draining() {
+		reject(msg)
+		return
+	}
+	var actionId string
+	var actionHandler handlers.ActionHandler
+
+	body := make(map[string]any)
+	err := msg.ReadJSON(&body)
+	if err != nil {
+		logger.ErrorF("Failed to decode message body: %v", err)
+		// the message can never be decoded, redelivering it would fail again
+		accept(msg)
+		return
+	}
+	pipeline := data.NewPipelineFrom(body)
+
+	actionId = pipeline.GetActionId()
+	actionHandler = handlers.Resolve(actionId)
+	if actionHandler == nil {
+		logger.ErrorF("Action not found: %s", actionId)
+		l.reportFailure(actionId, pipeline, handlers.ErrActionNotFound(actionId))
+		accept(msg)
+		return
+	}
+
+	utils.ApplyDefaults(actionHandler.Spec(), pipeline)
+	err = pipeline.Coerce(actionHandler.Spec().Parameters)
+	if err != nil {
+		logger.ErrorF("Failed to convert the parameters of action %s: %v", actionId, err)
+		// the message cannot be processed, report the failure instead of redelivering it
+		l.reportFailure(actionId, pipeline, err)
+		accept(msg)
+		return
+	}
+	if _, err = utils.ValidateInputs(actionHandler.Spec(), pipeline); err != nil {
+		logger.ErrorF("Invalid parameters of action %s: %v", actionId, err)
+		l.reportFailure(actionId, pipeline, err)
+		accept(msg)
+		return
+	}
+
+	// wait for a slot without consuming further messages
+	waitCtx, cancelWait := dispatch.Context(listenerCtx, nil)
+	defer cancelWait()
+	release, err := dispatch.Acquire(waitCtx, actionId, true)
+	if err != nil {
+		logger.ErrorF("Failed to acquire a slot for action %s: %v", actionId, err)
+		reject(msg)
+		return
+	}
+	defer release()
+	invocation := dispatch.Track(actionId, pipeline, func(err error) {
+		l.reportFailure(actionId, pipeline, err)
+	})
+	handlerCtx, cancel := dispatch.Context(listenerCtx, actionHandler.Spec())
+	defer cancel()
+	err = dispatch.Invoke(handlerCtx, actionId, actionHandler, pipeline)
+	if context.Cause(handlerCtx) == dispatch.ErrShutdown {
+		err = dispatch.ErrShutdown
+	}
+	invocation.Finish(func() {
+		var panicErr *handlers.PanicError
+		var quarantinedErr *dispatch.QuarantinedError
+		if errors.As(err, &panicErr) || errors.As(err, &quarantinedErr) || errors.Is(err, dispatch.ErrShutdown) {
+			// report the failure, the handler could not do so
+			l.reportFailure(actionId, pipeline, err)
+		}
+	})
+	accept(msg)
+	if err != nil {
+		logger.ErrorF("Failed to handle action: %v", err)
+		return
+	}
+}
+
+// reportFailure sends a failure event of the invocation of the action.
+func (l *MsgListener) reportFailure(actionId string, pipeline *data.Pipeline, err error) {
+	if l.client == nil {
+		return
+	}
+	if respondErr := l.client.RespondEvent(actionId, dispatch.FailureEvent(pipeline, err, models.ErrCodeActionFailed)); respondErr != nil {
+		logger.ErrorF("Failed to report the failure of action %s: %v", actionId, respondErr)
 	}
 }
@@ -0,0 +1,360 @@
+// Package outbox provides a durable, file-backed outbox for the step change events sent to the
+// Orcaloop server. Events are appended to a journal before they are delivered, a background
+// dispatcher delivers them with retries and records an acknowledgement once the server accepted
+// them. Events that are not acknowledged when the process stops are delivered again once the
+// outbox is reopened.
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"oss.nandlabs.io/golly/l3"
+	"oss.nandlabs.io/orcaloop-sdk/events"
+)
+
+const (
+	// DefaultMinBackoff is the default wait before the delivery of an event is retried.
+	DefaultMinBackoff = time.Second
+	// DefaultMaxBackoff is the default maximum wait between two deliveries of an event.
+	DefaultMaxBackoff = time.Minute
+)
+
+const (
+	opAdd = "add"
+	opAck = "ack"
+)
+
+// flushInterval is the interval at which Flush checks the pending events.
+const flushInterval = 50 * time.Millisecond
+
+var logger = l3.Get()
+
+// ErrPermanent is wrapped by the errors of a Sender for events the server rejected for good.
+// Such events are dropped from the outbox instead of being retried.
+var ErrPermanent = errors.New("event permanently rejected")
+
+var ErrClosed = errors.New("outbox is closed")
+
+// Sender delivers an event of an action to the Orcaloop server.
+type Sender func(actionId string, event *events.StepChangeEvent) error
+
+// Entry is an event waiting in the outbox for its delivery.
+type Entry struct {
+	Seq      uint64                  `json:"seq"`
+	ActionId string                  `json:"action_id"`
+	Event    *events.StepChangeEvent `json:"event"`
+}
+
+// record is a line of the journal.
+type record struct {
+	Op string `json:"op"`
+	*Entry
+}
+
+// Outbox is a durable queue of the events to be delivered to the Orcaloop server.
+// MinBackoff and MaxBackoff bound the wait before a failed delivery is retried, they must be set before Start.
+type Outbox struct {
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	mu         sync.Mutex
+	path       string
+	file       *os.File
+	pending    map[uint64]*Entry
+	seq        uint64
+	closed     bool
+	notify     chan struct{}
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+// Open opens the outbox journal at the path, creating it if it does not exist.
+// The entries that were not acknowledged are loaded to be delivered once the outbox is started
+// and the journal is compacted to hold them only.
+//
+// Parameters:
+//   - path: The path of the journal file.
+//
+// Returns:
+//   - *Outbox: The opened outbox.
+//   - error: An error if the journal cannot be read or written.
+func Open(path string) (ob *Outbox, err error) {
+	ob = &Outbox{
+		path:       path,
+		pending:    make(map[uint64]*Entry),
+		notify:     make(chan struct{}, 1),
+		MinBackoff: DefaultMinBackoff,
+		MaxBackoff: DefaultMaxBackoff,
+	}
+	if err = ob.load(); err != nil {
+		return nil, err
+	}
+	if err = ob.compact(); err != nil {
+		return nil, err
+	}
+	return
+}
+
+// load reads the journal and keeps the entries that were not acknowledged.
+func (ob *Outbox) load() (err error) {
+	var f *os.File
+	f, err = os.Open(ob.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		var r record
+		if err = json.Unmarshal(scanner.Bytes(), &r); err != nil || r.Entry == nil {
+			// a torn write at the end of the journal, the event was not acknowledged to the caller
+			logger.WarnF("Skipping invalid record at line %d of outbox %s", line, ob.path)
+			err = nil
+			continue
+		}
+		switch r.Op {
+		case opAdd:
+			ob.pending[r.Seq] = r.Entry
+		case opAck:
+			delete(ob.pending, r.Seq)
+		}
+		if r.Seq > ob.seq {
+			ob.seq = r.Seq
+		}
+	}
+	return scanner.Err()
+}
+
+// compact rewrites the journal with the pending entries only and opens it for appending.
+func (ob *Outbox) compact() (err error) {
+	tmp := ob.path + ".tmp"
+	var f *os.File
+	f, err = os.OpenFile(tmp, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	w := bufio.NewWriter(f)
+	for _, entry := range ob.entries() {
+		if err = writeRecord(w, record{Op: opAdd, Entry: entry}); err != nil {
+			f.Close()
+			return
+		}
+	}
+	if err = w.Flush(); err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return
+	}
+	if err = os.Rename(tmp, ob.path); err != nil {
+		return
+	}
+	if ob.file != nil {
+		ob.file.Close()
+	}
+	ob.file, err = os.OpenFile(ob.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	return
+}
+
+// writeRecord writes the record as a line of JSON.
+func writeRecord(w interface{ Write([]byte) (int, error) }, r record) error {
+	b, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// entries returns the pending entries in the order they were appended. Callers must hold the lock.
+func (ob *Outbox) entries() []*Entry {
+	entries := make([]*Entry, 0, len(ob.pending))
+	for _, entry := range ob.pending {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Seq < entries[j].Seq })
+	return entries
+}
+
+// Append writes the event to the journal and queues it for delivery.
+// It returns once the event is synced to disk.
+//
+// Parameters:
+//   - actionId: The id of the action whose invocation the event reports.
+//   - event: The event to be delivered.
+//
+// Returns:
+//
+//	ErrClosed if the outbox is stopped, an error if the journal cannot be written.
+func (ob *Outbox) Append(actionId string, event *events.StepChangeEvent) (err error) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.closed {
+		return ErrClosed
+	}
+	entry := &Entry{Seq: ob.seq + 1, ActionId: actionId, Event: event}
+	if err = writeRecord(ob.file, record{Op: opAdd, Entry: entry}); err != nil {
+		return fmt.Errorf("unable to write to outbox %s: %w", ob.path, err)
+	}
+	if err = ob.file.Sync(); err != nil {
+		return fmt.Errorf("unable to sync outbox %s: %w", ob.path, err)
+	}
+	ob.seq = entry.Seq
+	ob.pending[entry.Seq] = entry
+	select {
+	case ob.notify <- struct{}{}:
+	default:
+	}
+	return
+}
+
+// Pending returns the number of events waiting for their delivery.
+func (ob *Outbox) Pending() int {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return len(ob.pending)
+}
+
+// Flush waits until the pending events are delivered.
+//
+// Parameters:
+//   - ctx: The context bounding the wait.
+//
+// Returns:
+//
+//	The error of the context if it is done before the events are delivered.
+func (ob *Outbox) Flush(ctx context.Context) error {
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	for ob.Pending() > 0 {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+// ack records the delivery of the entry. The journal is truncated once no entry is pending.
+func (ob *Outbox) ack(entry *Entry) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.closed {
+		return
+	}
+	delete(ob.pending, entry.Seq)
+	if len(ob.pending) == 0 {
+		if err := ob.compact(); err == nil {
+			return
+		}
+	}
+	if err := writeRecord(ob.file, record{Op: opAck, Entry: &Entry{Seq: entry.Seq}}); err != nil {
+		// the event is delivered again after a restart, the server deduplicates it by its EventId
+		logger.ErrorF("Unable to acknowledge event %s in outbox %s: %v", entry.Event.EventId, ob.path, err)
+	}
+}
+
+// Start starts the background dispatcher delivering the pending events using the sender,
+// starting with the events loaded from the journal. Calling Start more than once has no effect.
+//
+// Parameters:
+//   - send: The sender delivering the events.
+func (ob *Outbox) Start(send Sender) {
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	if ob.stop != nil || ob.closed {
+		return
+	}
+	ob.stop = make(chan struct{})
+	ob.done = make(chan struct{})
+	go ob.dispatch(send)
+}
+
+// Stop stops the dispatcher and closes the journal. Pending events are delivered once the outbox is reopened.
+func (ob *Outbox) Stop() (err error) {
+	ob.mu.Lock()
+	if ob.closed {
+		ob.mu.Unlock()
+		return
+	}
+	ob.closed = true
+	stop, done := ob.stop, ob.done
+	ob.mu.Unlock()
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	ob.mu.Lock()
+	defer ob.mu.Unlock()
+	return ob.file.Close()
+}
+
+// dispatch delivers the pending entries in order until the outbox is stopped.
+// A failed delivery is retried with an exponential backoff before the next entries are delivered.
+func (ob *Outbox) dispatch(send Sender) {
+	defer close(ob.done)
+	backoff := ob.MinBackoff
+	for {
+		ob.mu.Lock()
+		entries := ob.entries()
+		ob.mu.Unlock()
+		failed := false
+		for _, entry := range entries {
+			err := send(entry.ActionId, entry.Event)
+			if err != nil && !errors.Is(err, ErrPermanent) {
+				logger.WarnF("Delivery of event %s failed, retrying in %s: %v", entry.Event.EventId, backoff, err)
+				failed = true
+				break
+			}
+			if err != nil {
+				logger.ErrorF("Dropping event %s rejected by the server: %v", entry.Event.EventId, err)
+			}
+			ob.ack(entry)
+			select {
+			case <-ob.stop:
+				return
+			default:
+			}
+		}
+		var wait <-chan time.Time
+		if failed {
+			wait = time.After(backoff)
+			backoff *= 2
+			if backoff > ob.MaxBackoff {
+				backoff = ob.MaxBackoff
+			}
+		} else {
+			backoff = ob.MinBackoff
+		}
+		select {
+		case <-ob.stop:
+			return
+		case <-ob.notify:
+			if failed {
+				// new events do not bypass the backoff of the failed one
+				select {
+				case <-ob.stop:
+					return
+				case <-wait:
+				}
+			}
+		case <-wait:
+		}
+	}
+}
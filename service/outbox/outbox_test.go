@@ -0,0 +1,169 @@
+package outbox
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/events"
+)
+
+// journalLines returns the number of records in the journal.
+func journalLines(t *testing.T, path string) int {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	lines := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lines++
+	}
+	return lines
+}
+
+func appendEvents(t *testing.T, ob *Outbox, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		if err := ob.Append("action", &events.StepChangeEvent{EventId: id}); err != nil {
+			t.Fatalf("Append(%s) error = %v", id, err)
+		}
+	}
+}
+
+// recorder is a Sender recording the delivered events, failing the deliveries while fail returns an error.
+type recorder struct {
+	mu        sync.Mutex
+	delivered []string
+	fail      func(event *events.StepChangeEvent) error
+}
+
+func (r *recorder) send(actionId string, event *events.StepChangeEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.fail != nil {
+		if err := r.fail(event); err != nil {
+			return err
+		}
+	}
+	r.delivered = append(r.delivered, event.EventId)
+	return nil
+}
+
+func (r *recorder) events() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.delivered...)
+}
+
+func TestReplayAfterReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.jsonl")
+	ob, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	appendEvents(t, ob, "e1", "e2", "e3")
+	// acknowledge e1 without a dispatcher, as if the process stopped after its delivery
+	ob.ack(ob.entries()[0])
+	if err = ob.Stop(); err != nil {
+		t.Fatal(err)
+	}
+	if err = ob.Append("action", &events.StepChangeEvent{EventId: "late"}); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Append() after Stop() error = %v, want %v", err, ErrClosed)
+	}
+
+	// a torn write at the end of the journal is skipped
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"op":"add","seq":4,"action_id":"act`)
+	f.Close()
+
+	ob, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Stop()
+	if ob.Pending() != 2 {
+		t.Fatalf("Pending() after reopening = %d, want 2", ob.Pending())
+	}
+	// the journal is compacted to hold the pending events only
+	if lines := journalLines(t, path); lines != 2 {
+		t.Fatalf("journal records after reopening = %d, want 2", lines)
+	}
+	appendEvents(t, ob, "e4")
+	if seq := ob.entries()[2].Seq; seq != 4 {
+		t.Fatalf("sequence of the appended event = %d, want 4", seq)
+	}
+
+	r := &recorder{}
+	ob.Start(r.send)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = ob.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprint(r.events()); got != "[e2 e3 e4]" {
+		t.Fatalf("delivered events = %s, want [e2 e3 e4]", got)
+	}
+	// the journal is truncated once every event is acknowledged
+	if lines := journalLines(t, path); lines != 0 {
+		t.Fatalf("journal records after the delivery = %d, want 0", lines)
+	}
+}
+
+func TestDispatchRetries(t *testing.T) {
+	ob, err := Open(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Stop()
+	ob.MinBackoff, ob.MaxBackoff = time.Millisecond, 4*time.Millisecond
+	attempts := 0
+	r := &recorder{fail: func(event *events.StepChangeEvent) error {
+		switch event.EventId {
+		case "rejected":
+			return fmt.Errorf("bad request: %w", ErrPermanent)
+		case "flaky":
+			attempts++
+			if attempts < 3 {
+				return errors.New("connection refused")
+			}
+		}
+		return nil
+	}}
+	appendEvents(t, ob, "flaky", "rejected", "ok")
+	ob.Start(r.send)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err = ob.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+	// the failed event is delivered before the next ones and the rejected one is dropped
+	if got := fmt.Sprint(r.events()); got != "[flaky ok]" || attempts != 3 {
+		t.Fatalf("delivered events = %s after %d attempts, want [flaky ok] after 3", got, attempts)
+	}
+}
+
+func TestFlushTimeout(t *testing.T) {
+	ob, err := Open(filepath.Join(t.TempDir(), "outbox.jsonl"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ob.Stop()
+	appendEvents(t, ob, "e1")
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err = ob.Flush(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Flush() without a dispatcher error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}
@@ -0,0 +1,132 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"oss.nandlabs.io/golly/clients"
+)
+
+// IdempotencyKeyHeader is the header identifying the attempts of a request whose method is not idempotent.
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+var ErrCircuitOpen = errors.New("circuit breaker of the orcaloop client is open")
+
+// idempotencyKeyCtx is the context key of the idempotency key of a request.
+type idempotencyKeyCtx struct{}
+
+// withIdempotencyKey sets the idempotency key of the requests sent with the context,
+// e.g. the id of the event they carry.
+func withIdempotencyKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, idempotencyKeyCtx{}, key)
+}
+
+// idempotencyKey returns the idempotency key set with withIdempotencyKey, if any.
+func idempotencyKey(ctx context.Context) string {
+	key, _ := ctx.Value(idempotencyKeyCtx{}).(string)
+	return key
+}
+
+// idempotent checks if requests of the method can be repeated without further effect.
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// RetryPolicy configures the retries of the requests of the OrcaloopClient.
+// Only failures that are safe to retry are retried: connection errors, 502 Bad Gateway,
+// 503 Service Unavailable, 504 Gateway Timeout and 429 Too Many Requests with a Retry-After header.
+// Requests whose method is not idempotent, such as the POST starting an instance, are sent with the same
+// IdempotencyKeyHeader on every attempt, the key of an event being its EventId, so that the server can
+// deduplicate a request it processed but whose response was lost.
+type RetryPolicy struct {
+	// MaxRetries is the number of retries after the first attempt, zero disables the retries
+	MaxRetries int
+	// InitialBackoff is the wait before the first retry
+	InitialBackoff time.Duration
+	// MaxBackoff caps the wait between two attempts, Retry-After included
+	MaxBackoff time.Duration
+	// Multiplier is the factor applied to the wait after every retry
+	Multiplier float64
+	// Jitter is the fraction of the wait that is randomized, between 0 and 1
+	Jitter float64
+}
+
+// DefaultRetryPolicy is the retry policy of the clients created with NewClient.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries:     3,
+	InitialBackoff: 200 * time.Millisecond,
+	MaxBackoff:     10 * time.Second,
+	Multiplier:     2,
+	Jitter:         0.2,
+}
+
+// DefaultBreakerInfo is the circuit breaker configuration of the clients created with NewClient.
+// The breaker opens after 5 consecutive failures and lets a request through after 30 seconds.
+var DefaultBreakerInfo = clients.BreakerInfo{
+	FailureThreshold: 5,
+	SuccessThreshold: 1,
+	MaxHalfOpen:      1,
+	Timeout:          30,
+}
+
+// backoff returns the wait before the retry, attempt being 1 for the first retry.
+func (p *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := p.Multiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	wait := float64(p.InitialBackoff) * math.Pow(multiplier, float64(attempt-1))
+	if p.Jitter > 0 {
+		jitter := math.Min(p.Jitter, 1)
+		// spread the wait uniformly over [wait*(1-jitter), wait*(1+jitter)]
+		wait += wait * jitter * (2*rand.Float64() - 1)
+	}
+	if p.MaxBackoff > 0 && wait > float64(p.MaxBackoff) {
+		wait = float64(p.MaxBackoff)
+	}
+	return time.Duration(wait)
+}
+
+// retryable checks if the outcome of an attempt can be retried and returns the wait requested by the server, if any.
+func retryable(res *response, err error) (retry bool, retryAfter time.Duration) {
+	if err != nil {
+		return !errors.Is(err, ErrCircuitOpen), 0
+	}
+	switch res.statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		retryAfter, _ = parseRetryAfter(res.header.Get("Retry-After"))
+		return true, retryAfter
+	case http.StatusTooManyRequests:
+		// the request may only be retried once the server says when
+		retryAfter, retry = parseRetryAfter(res.header.Get("Retry-After"))
+		return retry, retryAfter
+	}
+	return false, 0
+}
+
+// parseRetryAfter parses the value of a Retry-After header, either a number of seconds or an HTTP date.
+func parseRetryAfter(value string) (wait time.Duration, ok bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait = time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
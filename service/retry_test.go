@@ -0,0 +1,117 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/events"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second, Multiplier: 2}
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{attempt: 1, want: 100 * time.Millisecond},
+		{attempt: 2, want: 200 * time.Millisecond},
+		{attempt: 4, want: 800 * time.Millisecond},
+		{attempt: 5, want: time.Second},
+	}
+	for _, tt := range tests {
+		if got := policy.backoff(tt.attempt); got != tt.want {
+			t.Errorf("backoff(%d) = %v, want %v", tt.attempt, got, tt.want)
+		}
+	}
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if got := policy.backoff(1); got < 50*time.Millisecond || got > 150*time.Millisecond {
+			t.Fatalf("backoff(1) with jitter = %v, want within [50ms, 150ms]", got)
+		}
+	}
+}
+
+func TestRetryable(t *testing.T) {
+	withRetryAfter := http.Header{"Retry-After": []string{"2"}}
+	tests := []struct {
+		name           string
+		res            *response
+		err            error
+		wantRetry      bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "connection error", err: errors.New("connection refused"), wantRetry: true},
+		{name: "circuit open", err: ErrCircuitOpen, wantRetry: false},
+		{name: "bad gateway", res: &response{statusCode: http.StatusBadGateway}, wantRetry: true},
+		{name: "unavailable with retry after", res: &response{statusCode: http.StatusServiceUnavailable, header: withRetryAfter}, wantRetry: true, wantRetryAfter: 2 * time.Second},
+		{name: "too many requests without retry after", res: &response{statusCode: http.StatusTooManyRequests}, wantRetry: false},
+		{name: "too many requests with retry after", res: &response{statusCode: http.StatusTooManyRequests, header: withRetryAfter}, wantRetry: true, wantRetryAfter: 2 * time.Second},
+		{name: "internal server error", res: &response{statusCode: http.StatusInternalServerError}, wantRetry: false},
+		{name: "bad request", res: &response{statusCode: http.StatusBadRequest}, wantRetry: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if tt.res != nil && tt.res.header == nil {
+				tt.res.header = http.Header{}
+			}
+			retry, retryAfter := retryable(tt.res, tt.err)
+			if retry != tt.wantRetry || retryAfter != tt.wantRetryAfter {
+				t.Fatalf("retryable() = %v, %v, want %v, %v", retry, retryAfter, tt.wantRetry, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	if wait, ok := parseRetryAfter("3"); !ok || wait != 3*time.Second {
+		t.Fatalf("parseRetryAfter(\"3\") = %v, %v", wait, ok)
+	}
+	if wait, ok := parseRetryAfter(time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat)); !ok || wait != 0 {
+		t.Fatalf("parseRetryAfter(past date) = %v, %v", wait, ok)
+	}
+	if _, ok := parseRetryAfter("soon"); ok {
+		t.Fatal("parseRetryAfter(\"soon\") accepted an invalid value")
+	}
+}
+
+func TestRespondRetriesWithStableEventId(t *testing.T) {
+	statuses := []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK}
+	var mu sync.Mutex
+	var eventIds []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var event events.StepChangeEvent
+		if err := json.NewDecoder(r.Body).Decode(&event); err != nil {
+			t.Errorf("decoding the event: %v", err)
+		}
+		if key := r.Header.Get(IdempotencyKeyHeader); key != event.EventId {
+			t.Errorf("idempotency key = %q, want the event id %q", key, event.EventId)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		eventIds = append(eventIds, event.EventId)
+		w.WriteHeader(statuses[len(eventIds)-1])
+	}))
+	defer srv.Close()
+
+	oc := NewClient(srv.URL, WithRetryPolicy(RetryPolicy{MaxRetries: 3, InitialBackoff: time.Millisecond}), WithCircuitBreaker(nil))
+	pipeline := data.NewPipeline("instance")
+	pipeline.Set(data.StepIdKey, "step")
+	pipeline.Set(data.WorkflowIdKey, "workflow")
+	keys := len(pipeline.Keys())
+	if err := oc.Respond(models.ActionSpec{Id: "action"}, pipeline); err != nil {
+		t.Fatalf("Respond() error = %v", err)
+	}
+	if len(eventIds) != 3 || eventIds[0] == "" || eventIds[0] != eventIds[1] || eventIds[1] != eventIds[2] {
+		t.Fatalf("event ids = %v, want 3 identical ids", eventIds)
+	}
+	if len(pipeline.Keys()) != keys {
+		t.Fatalf("Respond() changed the pipeline, keys = %v", pipeline.Keys())
+	}
+}
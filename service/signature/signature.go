@@ -0,0 +1,134 @@
+// Package signature signs and verifies the requests exchanged by the Orcaloop server and the action
+// services using HMAC-SHA256 over a shared secret. The signature covers a timestamp, the method, the
+// path, the raw query and the body of the request, and requests whose timestamp is outside the
+// tolerance window are rejected to prevent replays. Several secrets can be active at once so that
+// they can be rotated: requests are signed with the first secret and verified against each of them.
+package signature
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// TimestampHeader is the header holding the unix time, in seconds, at which the request was signed.
+	TimestampHeader = "X-Orcaloop-Timestamp"
+	// SignatureHeader is the header holding the signature of the request.
+	SignatureHeader = "X-Orcaloop-Signature"
+	// SchemeV1 prefixes the hex encoded HMAC-SHA256 signatures in the SignatureHeader.
+	SchemeV1 = "v1="
+	// DefaultTolerance is the default maximum difference between the timestamp of a request and the time it is verified.
+	DefaultTolerance = 5 * time.Minute
+)
+
+var ErrNoSecret = errors.New("no signing secret configured")
+var ErrMissingSignature = errors.New("request signature is missing")
+var ErrInvalidTimestamp = errors.New("request timestamp is invalid")
+var ErrExpiredTimestamp = errors.New("request timestamp is outside the tolerance window")
+var ErrInvalidSignature = errors.New("request signature is invalid")
+
+// Signer signs and verifies requests with a set of shared secrets.
+type Signer struct {
+	secrets   [][]byte
+	tolerance time.Duration
+	now       func() time.Time
+}
+
+// NewSigner creates a new Signer.
+//
+// Parameters:
+//   - secrets: The active secrets, requests are signed with the first one and verified against all of them.
+//   - tolerance: The tolerance window of the timestamps, DefaultTolerance if not positive.
+//
+// Returns:
+//   - *Signer: The signer.
+//   - error: ErrNoSecret if no secret is set.
+func NewSigner(secrets []string, tolerance time.Duration) (*Signer, error) {
+	s := &Signer{
+		tolerance: tolerance,
+		now:       time.Now,
+	}
+	if s.tolerance <= 0 {
+		s.tolerance = DefaultTolerance
+	}
+	for _, secret := range secrets {
+		if secret != "" {
+			s.secrets = append(s.secrets, []byte(secret))
+		}
+	}
+	if len(s.secrets) == 0 {
+		return nil, ErrNoSecret
+	}
+	return s, nil
+}
+
+// Sign sets the timestamp and signature headers of the request.
+//
+// Parameters:
+//   - req: The request.
+//   - body: The body of the request, nil if it has none.
+func (s *Signer) Sign(req *http.Request, body []byte) {
+	timestamp := strconv.FormatInt(s.now().Unix(), 10)
+	req.Header.Set(TimestampHeader, timestamp)
+	req.Header.Set(SignatureHeader, SchemeV1+hex.EncodeToString(compute(s.secrets[0], timestamp, req.Method, req.URL.Path, req.URL.RawQuery, body)))
+}
+
+// Verify verifies the timestamp and signature headers of the request.
+// The signature header may hold several comma separated signatures, the request is valid if
+// any of them matches any of the secrets.
+//
+// Parameters:
+//   - req: The request.
+//   - body: The body of the request, nil if it has none.
+//
+// Returns:
+//
+//	ErrMissingSignature, ErrInvalidTimestamp, ErrExpiredTimestamp or ErrInvalidSignature if
+//	the request is rejected, otherwise nil.
+func (s *Signer) Verify(req *http.Request, body []byte) error {
+	timestamp := req.Header.Get(TimestampHeader)
+	header := req.Header.Get(SignatureHeader)
+	if timestamp == "" || header == "" {
+		return ErrMissingSignature
+	}
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidTimestamp, err)
+	}
+	skew := s.now().Sub(time.Unix(seconds, 0))
+	if skew > s.tolerance || skew < -s.tolerance {
+		return ErrExpiredTimestamp
+	}
+	for _, value := range strings.Split(header, ",") {
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(value, SchemeV1) {
+			continue
+		}
+		signature, err := hex.DecodeString(strings.TrimPrefix(value, SchemeV1))
+		if err != nil {
+			continue
+		}
+		for _, secret := range s.secrets {
+			if hmac.Equal(signature, compute(secret, timestamp, req.Method, req.URL.Path, req.URL.RawQuery, body)) {
+				return nil
+			}
+		}
+	}
+	return ErrInvalidSignature
+}
+
+// compute computes the HMAC-SHA256 of the timestamp, method, path, raw query and body of a request,
+// separated by new lines.
+func compute(secret []byte, timestamp, method, path, rawQuery string, body []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp + "\n" + method + "\n" + path + "\n" + rawQuery + "\n"))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
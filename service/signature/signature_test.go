@@ -0,0 +1,85 @@
+package signature
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestSignAndVerify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	signer, err := NewSigner([]string{"current"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer.now = func() time.Time { return now }
+	verifier, err := NewSigner([]string{"", "next", "current"}, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := []byte(`{"a":1}`)
+
+	tests := []struct {
+		name    string
+		modify  func(req *http.Request)
+		body    []byte
+		at      time.Time
+		wantErr error
+	}{
+		{name: "valid", body: body, at: now},
+		{name: "within tolerance", body: body, at: now.Add(59 * time.Second)},
+		{name: "expired", body: body, at: now.Add(2 * time.Minute), wantErr: ErrExpiredTimestamp},
+		{name: "from the future", body: body, at: now.Add(-2 * time.Minute), wantErr: ErrExpiredTimestamp},
+		{name: "body tampered", body: []byte(`{"a":2}`), at: now, wantErr: ErrInvalidSignature},
+		{name: "query tampered", body: body, at: now, modify: func(req *http.Request) { req.URL.RawQuery = "async=false" }, wantErr: ErrInvalidSignature},
+		{name: "path tampered", body: body, at: now, modify: func(req *http.Request) { req.URL.Path = "/api/v1/actions/other" }, wantErr: ErrInvalidSignature},
+		{name: "method tampered", body: body, at: now, modify: func(req *http.Request) { req.Method = http.MethodPut }, wantErr: ErrInvalidSignature},
+		{name: "missing signature", body: body, at: now, modify: func(req *http.Request) { req.Header.Del(SignatureHeader) }, wantErr: ErrMissingSignature},
+		{name: "missing timestamp", body: body, at: now, modify: func(req *http.Request) { req.Header.Del(TimestampHeader) }, wantErr: ErrMissingSignature},
+		{name: "invalid timestamp", body: body, at: now, modify: func(req *http.Request) { req.Header.Set(TimestampHeader, "now") }, wantErr: ErrInvalidTimestamp},
+		{name: "unknown scheme", body: body, at: now, modify: func(req *http.Request) { req.Header.Set(SignatureHeader, "v2=00") }, wantErr: ErrInvalidSignature},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/v1/actions/action?async=true", nil)
+			signer.Sign(req, body)
+			if tt.modify != nil {
+				tt.modify(req)
+			}
+			verifier.now = func() time.Time { return tt.at }
+			if err := verifier.Verify(req, tt.body); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyRotatedSecrets(t *testing.T) {
+	old, _ := NewSigner([]string{"old"}, 0)
+	current, _ := NewSigner([]string{"current"}, 0)
+	verifier, _ := NewSigner([]string{"current", "old"}, 0)
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/actions/action", nil)
+
+	old.Sign(req, nil)
+	if err := verifier.Verify(req, nil); err != nil {
+		t.Fatalf("Verify() of the old secret error = %v", err)
+	}
+	signedByOld := req.Header.Get(SignatureHeader)
+	current.Sign(req, nil)
+	if err := old.Verify(req, nil); !errors.Is(err, ErrInvalidSignature) {
+		t.Fatalf("Verify() with a retired secret error = %v, want %v", err, ErrInvalidSignature)
+	}
+	// several signatures may be sent while the secrets rotate
+	req.Header.Set(SignatureHeader, "v1=00, "+signedByOld)
+	if err := verifier.Verify(req, nil); err != nil {
+		t.Fatalf("Verify() of several signatures error = %v", err)
+	}
+}
+
+func TestNewSignerWithoutSecret(t *testing.T) {
+	if _, err := NewSigner([]string{""}, 0); !errors.Is(err, ErrNoSecret) {
+		t.Fatalf("NewSigner() error = %v, want %v", err, ErrNoSecret)
+	}
+}
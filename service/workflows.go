@@ -0,0 +1,236 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+const (
+	WorkflowsEndpoint        = "/api/workflows"
+	WorkflowEndpoint         = "/api/workflows/:workflowId"
+	WorkflowVersionsEndpoint = "/api/workflows/:workflowId/versions"
+	WorkflowVersionEndpoint  = "/api/workflows/:workflowId/versions/:version"
+)
+
+var ErrWorkflowIdRequired = errors.New("workflow id is required")
+
+// ListOptions holds the filter and the pagination of a list request.
+type ListOptions struct {
+	// Name filters the results by name, ignored if empty
+	Name string
+	// Page is the page to fetch, starting at 1, the server default is used if not positive
+	Page int
+	// PageSize is the maximum number of results per page, the server default is used if not positive
+	PageSize int
+}
+
+// query encodes the options as query parameters.
+func (o *ListOptions) query() url.Values {
+	q := url.Values{}
+	if o == nil {
+		return q
+	}
+	if o.Name != "" {
+		q.Set("name", o.Name)
+	}
+	if o.Page > 0 {
+		q.Set("page", strconv.Itoa(o.Page))
+	}
+	if o.PageSize > 0 {
+		q.Set("page_size", strconv.Itoa(o.PageSize))
+	}
+	return q
+}
+
+// withQuery appends the query parameters to the path.
+func withQuery(path string, q url.Values) string {
+	if len(q) == 0 {
+		return path
+	}
+	return path + "?" + q.Encode()
+}
+
+// workflowPath returns the path of the endpoint for the workflow id and version.
+func workflowPath(endpoint, workflowId string, version int) string {
+	endpoint = strings.ReplaceAll(endpoint, ":workflowId", url.PathEscape(workflowId))
+	return strings.ReplaceAll(endpoint, ":version", strconv.Itoa(version))
+}
+
+// CreateWorkflow creates the workflow definition on the Orcaloop server.
+// The workflow is validated by the server, use utils.ValidateWorkflow to validate it beforehand.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflow: The workflow to be created.
+//
+// Returns:
+//   - created: The workflow as stored by the server, including its version.
+//   - err: An *APIError if the server rejected the workflow, e.g. matching ErrConflict if it exists.
+func (oc *OrcaloopClient) CreateWorkflow(ctx context.Context, workflow *models.Workflow) (created *models.Workflow, err error) {
+	created = &models.Workflow{}
+	if err = oc.call(ctx, http.MethodPost, WorkflowsEndpoint, workflow, created); err != nil {
+		created = nil
+	}
+	return
+}
+
+// UpdateWorkflow replaces the latest version of the workflow definition on the Orcaloop server.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflow: The workflow to be updated, identified by its Id.
+//
+// Returns:
+//   - updated: The workflow as stored by the server.
+//   - err: An *APIError if the server rejected the workflow, e.g. matching ErrNotFound if it does not exist.
+func (oc *OrcaloopClient) UpdateWorkflow(ctx context.Context, workflow *models.Workflow) (updated *models.Workflow, err error) {
+	if workflow.Id == "" {
+		return nil, ErrWorkflowIdRequired
+	}
+	updated = &models.Workflow{}
+	if err = oc.call(ctx, http.MethodPut, workflowPath(WorkflowEndpoint, workflow.Id, 0), workflow, updated); err != nil {
+		updated = nil
+	}
+	return
+}
+
+// GetWorkflow fetches the latest version of the workflow definition.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflowId: The id of the workflow.
+//
+// Returns:
+//   - workflow: The workflow.
+//   - err: An *APIError matching ErrNotFound if the workflow does not exist.
+func (oc *OrcaloopClient) GetWorkflow(ctx context.Context, workflowId string) (workflow *models.Workflow, err error) {
+	if workflowId == "" {
+		return nil, ErrWorkflowIdRequired
+	}
+	workflow = &models.Workflow{}
+	if err = oc.call(ctx, http.MethodGet, workflowPath(WorkflowEndpoint, workflowId, 0), nil, workflow); err != nil {
+		workflow = nil
+	}
+	return
+}
+
+// ListWorkflows lists the latest version of the workflow definitions.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - opts: The name filter and the page to fetch, nil lists the first page of all the workflows.
+//
+// Returns:
+//   - list: The page of workflows.
+//   - err: An *APIError if the request failed.
+func (oc *OrcaloopClient) ListWorkflows(ctx context.Context, opts *ListOptions) (list *models.WorkflowList, err error) {
+	list = &models.WorkflowList{}
+	if err = oc.call(ctx, http.MethodGet, withQuery(WorkflowsEndpoint, opts.query()), nil, list); err != nil {
+		list = nil
+	}
+	return
+}
+
+// DeleteWorkflow deletes the workflow definition with all its versions.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflowId: The id of the workflow.
+//
+// Returns:
+//
+//	An *APIError matching ErrNotFound if the workflow does not exist.
+func (oc *OrcaloopClient) DeleteWorkflow(ctx context.Context, workflowId string) error {
+	if workflowId == "" {
+		return ErrWorkflowIdRequired
+	}
+	return oc.call(ctx, http.MethodDelete, workflowPath(WorkflowEndpoint, workflowId, 0), nil, nil)
+}
+
+// CreateWorkflowVersion creates a new version of an existing workflow definition.
+// The previous versions are kept, running instances continue with the version they started with.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflow: The new definition of the workflow, identified by its Id.
+//
+// Returns:
+//   - created: The workflow as stored by the server, with the Version assigned by the server.
+//   - err: An *APIError matching ErrNotFound if the workflow does not exist.
+func (oc *OrcaloopClient) CreateWorkflowVersion(ctx context.Context, workflow *models.Workflow) (created *models.Workflow, err error) {
+	if workflow.Id == "" {
+		return nil, ErrWorkflowIdRequired
+	}
+	created = &models.Workflow{}
+	if err = oc.call(ctx, http.MethodPost, workflowPath(WorkflowVersionsEndpoint, workflow.Id, 0), workflow, created); err != nil {
+		created = nil
+	}
+	return
+}
+
+// GetWorkflowVersion fetches a version of the workflow definition.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflowId: The id of the workflow.
+//   - version: The version of the workflow.
+//
+// Returns:
+//   - workflow: The version of the workflow.
+//   - err: An *APIError matching ErrNotFound if the workflow or the version does not exist.
+func (oc *OrcaloopClient) GetWorkflowVersion(ctx context.Context, workflowId string, version int) (workflow *models.Workflow, err error) {
+	if workflowId == "" {
+		return nil, ErrWorkflowIdRequired
+	}
+	workflow = &models.Workflow{}
+	if err = oc.call(ctx, http.MethodGet, workflowPath(WorkflowVersionEndpoint, workflowId, version), nil, workflow); err != nil {
+		workflow = nil
+	}
+	return
+}
+
+// ListWorkflowVersions lists the versions of the workflow definition.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflowId: The id of the workflow.
+//   - opts: The page to fetch, the name filter is ignored. nil fetches the first page.
+//
+// Returns:
+//   - list: The page of versions of the workflow.
+//   - err: An *APIError matching ErrNotFound if the workflow does not exist.
+func (oc *OrcaloopClient) ListWorkflowVersions(ctx context.Context, workflowId string, opts *ListOptions) (list *models.WorkflowList, err error) {
+	if workflowId == "" {
+		return nil, ErrWorkflowIdRequired
+	}
+	q := opts.query()
+	q.Del("name")
+	list = &models.WorkflowList{}
+	if err = oc.call(ctx, http.MethodGet, withQuery(workflowPath(WorkflowVersionsEndpoint, workflowId, 0), q), nil, list); err != nil {
+		list = nil
+	}
+	return
+}
+
+// DeleteWorkflowVersion deletes a version of the workflow definition.
+//
+// Parameters:
+//   - ctx: The context of the request.
+//   - workflowId: The id of the workflow.
+//   - version: The version to be deleted.
+//
+// Returns:
+//
+//	An *APIError matching ErrNotFound if the workflow or the version does not exist.
+func (oc *OrcaloopClient) DeleteWorkflowVersion(ctx context.Context, workflowId string, version int) error {
+	if workflowId == "" {
+		return ErrWorkflowIdRequired
+	}
+	return oc.call(ctx, http.MethodDelete, workflowPath(WorkflowVersionEndpoint, workflowId, version), nil, nil)
+}
@@ -0,0 +1,272 @@
+package utils
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"oss.nandlabs.io/golly/errutils"
+	"oss.nandlabs.io/orcaloop-sdk/data"
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+// SchemaViolation describes a value that does not conform to its schema.
+// Path is the JSON pointer (RFC 6901) of the value, e.g. /order/items/0/qty.
+type SchemaViolation struct {
+	Path    string
+	Message string
+}
+
+// Error implements the error interface.
+func (v *SchemaViolation) Error() string {
+	path := v.Path
+	if path == "" {
+		path = "/"
+	}
+	return fmt.Sprintf("%s: %s", path, v.Message)
+}
+
+// ValidateValue validates the value against the schema.
+// It checks the value against the Type, Enum, Items and Properties of the schema recursively
+// and reports every violation as a *SchemaViolation. Nil values are only checked by the
+// Required flag of the properties of an object.
+//
+// Parameters:
+//   - schema: The schema the value must conform to.
+//   - value: The value to be validated.
+//
+// Returns:
+//   - err: An *errutils.MultiError holding a *SchemaViolation for every violation, or nil if the value is valid.
+func ValidateValue(schema *models.Schema, value any) (err error) {
+	multiError := errutils.NewMultiErr(nil)
+	validateValue(schema, value, "", multiError)
+	if multiError.HasErrors() {
+		err = multiError
+	}
+	return
+}
+
+// validateValue validates the value against the schema and adds the violations to the multiError.
+func validateValue(schema *models.Schema, value any, path string, multiError *errutils.MultiError) {
+	if schema == nil || value == nil {
+		return
+	}
+	violation := func(format string, args ...any) {
+		multiError.Add(&SchemaViolation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+	switch schema.Type {
+	case models.FieldTypeString:
+		if _, ok := value.(string); !ok {
+			violation("expected a string, got %T", value)
+		}
+	case models.FieldTypeDateStr:
+		if _, err := data.ToTime(value); err != nil {
+			violation("expected a date, got %v (%T)", value, value)
+		}
+	case models.FieldTypeInt, models.FieldTypeInt64, models.FieldTypeByte:
+		if !isNumber(value) {
+			violation("expected an integer, got %T", value)
+			break
+		}
+		i, err := data.ToInt64(value)
+		if err != nil {
+			violation("expected an integer, got %v", value)
+			break
+		}
+		if schema.Type == models.FieldTypeByte && (i < 0 || i > math.MaxUint8) {
+			violation("byte %d out of range", i)
+		}
+	case models.FieldTypeFloat32, models.FieldTypeFloat64:
+		if !isNumber(value) {
+			violation("expected a number, got %T", value)
+		}
+	case models.FieldTypeBool:
+		if _, ok := value.(bool); !ok {
+			violation("expected a boolean, got %T", value)
+		}
+	case models.FieldTypeObject:
+		m, err := data.ToMap(value)
+		if err != nil {
+			violation("expected an object, got %T", value)
+			break
+		}
+		for _, property := range schema.Properties {
+			propertyPath := path + "/" + escapePointer(property.Name)
+			v, ok := m[property.Name]
+			if !ok || v == nil {
+				if property.Required {
+					multiError.Add(&SchemaViolation{Path: propertyPath, Message: "missing required property"})
+				}
+				continue
+			}
+			validateValue(property, v, propertyPath, multiError)
+		}
+	case models.FieldTypeArray:
+		items, err := data.ToSlice(value)
+		if err != nil {
+			violation("expected an array, got %T", value)
+			break
+		}
+		for i, item := range items {
+			validateValue(schema.Items, item, path+"/"+strconv.Itoa(i), multiError)
+		}
+	}
+
+	if schema.Enum != nil {
+		allowed, err := data.ToSlice(schema.Enum)
+		if err != nil {
+			allowed = []any{schema.Enum}
+		}
+		for _, a := range allowed {
+			if data.Equal(value, a) {
+				return
+			}
+		}
+		violation("value %v is not one of %v", value, allowed)
+	}
+}
+
+// isNumber checks if the value is of a numeric type, excluding numeric strings.
+func isNumber(value any) bool {
+	if _, ok := value.(string); ok {
+		return false
+	}
+	_, err := data.ToFloat64(value)
+	return err == nil
+}
+
+// escapePointer escapes a reference token of a JSON pointer as per RFC 6901.
+func escapePointer(token string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(token, "~", "~0"), "/", "~1")
+}
+
+// validateSchemas validates the values of the pipeline named by the schemas.
+// Missing or nil values are reported only if the schema is required.
+func validateSchemas(schemas []*models.Schema, pipeline *data.Pipeline, missing string, multiError *errutils.MultiError) {
+	for _, schema := range schemas {
+		value, err := pipeline.Get(schema.Name)
+		if err != nil || value == nil {
+			if schema.Required {
+				multiError.Add(fmt.Errorf("%s %s", missing, schema.Name))
+			}
+			continue
+		}
+		validateValue(schema, value, "/"+escapePointer(schema.Name), multiError)
+	}
+}
+
+// ValidateOutputs checks the outputs of a handler held by the pipeline against the Returns of the actionSpec.
+// Required returns must be present and every return present must conform to its schema.
+//
+// Parameters:
+//   - actionSpec: A pointer to an ActionSpec struct containing the returns to validate.
+//   - pipeline: A pointer to a Pipeline struct holding the outputs of the handler.
+//
+// Returns:
+//   - valid: A boolean indicating whether the outputs are valid.
+//   - err: An *errutils.MultiError containing details of every violation, or nil if all outputs are valid.
+func ValidateOutputs(actionSpec *models.ActionSpec, pipeline *data.Pipeline) (valid bool, err error) {
+	multiError := errutils.NewMultiErr(nil)
+	validateSchemas(actionSpec.Returns, pipeline, "missing required output", multiError)
+	if multiError.HasErrors() {
+		err = multiError
+		return
+	}
+	valid = true
+	return
+}
+
+// ApplyDefaults fills the parameters of the actionSpec that are missing from the pipeline with
+// their Default values. It recurses into the Properties of objects and the Items of arrays present
+// in the pipeline, filling their missing properties as well. Defaults are copied deeply, so handlers
+// can modify the values without changing the spec. Values present in the pipeline are never replaced,
+// the objects and arrays holding them are copied before missing properties are filled.
+//
+// Parameters:
+//   - actionSpec: A pointer to an ActionSpec struct containing the parameters with their defaults.
+//   - pipeline: A pointer to a Pipeline struct where the defaults are applied.
+func ApplyDefaults(actionSpec *models.ActionSpec, pipeline *data.Pipeline) {
+	for _, param := range actionSpec.Parameters {
+		value, err := pipeline.Get(param.Name)
+		if value, changed := applyDefault(param, value, err == nil); changed {
+			pipeline.Set(param.Name, value)
+		}
+	}
+}
+
+// applyDefault returns the value with the defaults of the schema applied.
+// changed is false if the value is returned unchanged.
+func applyDefault(schema *models.Schema, value any, present bool) (result any, changed bool) {
+	if schema == nil {
+		return value, false
+	}
+	if !present || value == nil {
+		if schema.Default == nil {
+			return value, false
+		}
+		return copyValue(schema.Default), true
+	}
+	switch schema.Type {
+	case models.FieldTypeObject:
+		m, ok := value.(map[string]any)
+		if !ok {
+			return value, false
+		}
+		var filled map[string]any
+		for _, property := range schema.Properties {
+			v, found := m[property.Name]
+			if v, propertyChanged := applyDefault(property, v, found); propertyChanged {
+				if filled == nil {
+					filled = make(map[string]any, len(m)+1)
+					for k, val := range m {
+						filled[k] = val
+					}
+				}
+				filled[property.Name] = v
+			}
+		}
+		if filled != nil {
+			return filled, true
+		}
+	case models.FieldTypeArray:
+		items, ok := value.([]any)
+		if !ok {
+			return value, false
+		}
+		var filled []any
+		for i, item := range items {
+			if v, itemChanged := applyDefault(schema.Items, item, true); itemChanged {
+				if filled == nil {
+					filled = make([]any, len(items))
+					copy(filled, items)
+				}
+				filled[i] = v
+			}
+		}
+		if filled != nil {
+			return filled, true
+		}
+	}
+	return value, false
+}
+
+// copyValue returns a deep copy of maps and arrays decoded from JSON or YAML. Other values are returned as is.
+func copyValue(value any) any {
+	switch v := value.(type) {
+	case map[string]any:
+		copied := make(map[string]any, len(v))
+		for k, val := range v {
+			copied[k] = copyValue(val)
+		}
+		return copied
+	case []any:
+		copied := make([]any, len(v))
+		for i, val := range v {
+			copied[i] = copyValue(val)
+		}
+		return copied
+	default:
+		return value
+	}
+}
@@ -156,8 +156,8 @@ func ValidateWorkflow(workflow models.Workflow) (err error) {
 //
 // Validation rules:
 //   - For StepTypeAction: The Action field must not be nil.
-//   - For StepTypeIf: The If field must not be nil, Condition must not be empty,
-//     Steps must not be empty, and all sub-steps must be valid. ElseIf and Else
+//   - For StepTypeIf: The If field must not be nil, Condition must not be empty and
+//     must compile, Steps must not be empty, and all sub-steps must be valid. ElseIf and Else
 //     blocks, if present, must also be valid.
 //   - For StepTypeParallel: The Parallel field must not be nil, Steps must not be
 //     empty, and all sub-steps must be valid.
@@ -181,6 +181,9 @@ func ValidateStep(step *models.Step) (err error) {
 		if step.If.Condition == "" {
 			return fmt.Errorf("missing condition for if step %s", step.Id)
 		}
+		if _, err = data.CompileCondition(step.If.Condition); err != nil {
+			return fmt.Errorf("invalid condition for if step %s: %w", step.Id, err)
+		}
 		if len(step.If.Steps) == 0 {
 			return fmt.Errorf("missing steps for if step %s", step.Id)
 		}
@@ -197,6 +200,9 @@ func ValidateStep(step *models.Step) (err error) {
 				if elseIf.Condition == "" {
 					return fmt.Errorf("missing condition for else-if step %s", step.Id)
 				}
+				if _, err = data.CompileCondition(elseIf.Condition); err != nil {
+					return fmt.Errorf("invalid condition for else-if step %s: %w", step.Id, err)
+				}
 				if len(elseIf.Steps) == 0 {
 					return fmt.Errorf("missing steps for else-if step %s", step.Id)
 				}
@@ -294,26 +300,21 @@ func ValidateStep(step *models.Step) (err error) {
 	return
 }
 
-// ValidateInputs checks if all required inputs specified in the actionSpec are present in the pipeline.
-// It returns a boolean indicating whether the inputs are valid and an error if any required inputs are missing.
+// ValidateInputs checks if all required inputs specified in the actionSpec are present in the pipeline
+// and if every input present conforms to its schema, see ValidateValue.
+// It returns a boolean indicating whether the inputs are valid and an error if any required inputs are missing
+// or any input is invalid.
 //
 // Parameters:
 //   - actionSpec: A pointer to an ActionSpec struct containing the parameters to validate.
 //   - pipeline: A pointer to a Pipeline struct where the inputs are checked.
 //
 // Returns:
-//   - valid: A boolean indicating whether all required inputs are present.
-//   - err: An error containing details of any missing required inputs, or nil if all inputs are valid.
+//   - valid: A boolean indicating whether all required inputs are present and valid.
+//   - err: An error containing details of any missing or invalid inputs, or nil if all inputs are valid.
 func ValidateInputs(actionSpec *models.ActionSpec, pipeline *data.Pipeline) (valid bool, err error) {
 	var multiError *errutils.MultiError = errutils.NewMultiErr(nil)
-	for _, input := range actionSpec.Parameters {
-		if input.Required {
-			if !pipeline.Has(input.Name) {
-				err = fmt.Errorf("missing required input %s", input.Name)
-				multiError.Add(err)
-			}
-		}
-	}
+	validateSchemas(actionSpec.Parameters, pipeline, "missing required input", multiError)
 	if multiError.HasErrors() {
 		err = multiError
 		valid = false
@@ -0,0 +1,50 @@
+package utils
+
+import (
+	"testing"
+
+	"oss.nandlabs.io/orcaloop-sdk/models"
+)
+
+func TestValidateStepVariables(t *testing.T) {
+	action := func(pipelineVar string) *models.Step {
+		return &models.Step{Id: "s", Type: models.StepTypeAction, Action: &models.StepAction{
+			Id:      "a",
+			Results: []*models.Result{{OutputVar: "out", PipelineVar: pipelineVar}},
+		}}
+	}
+	loop := func(loopVar string) *models.Step {
+		return &models.Step{Id: "s", Type: models.StepTypeForLoop, For: &models.For{
+			Loopvar:  loopVar,
+			ItemsArr: []any{1},
+			Steps:    []*models.Step{action("item")},
+		}}
+	}
+	condition := func(condition string) *models.Step {
+		return &models.Step{Id: "s", Type: models.StepTypeIf, If: &models.If{
+			Condition: condition,
+			Steps:     []*models.Step{action("x")},
+		}}
+	}
+	tests := []struct {
+		name    string
+		step    *models.Step
+		wantErr bool
+	}{
+		{name: "result", step: action("order_id")},
+		{name: "keyword result", step: action("matches")},
+		{name: "hyphenated result", step: action("order-id")},
+		{name: "loop variable", step: loop("item")},
+		{name: "hyphenated loop variable", step: loop("line-item")},
+		{name: "condition", step: condition(`in in ["a"] && order_id - 1 > 0`)},
+		{name: "hyphenated condition", step: condition("order-id > 0"), wantErr: true},
+		{name: "hyphenated condition with a digit", step: condition("order-1 > 0"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateStep(tt.step); (err != nil) != tt.wantErr {
+				t.Fatalf("ValidateStep() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}